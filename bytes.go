@@ -0,0 +1,175 @@
+package onetimesecret
+
+import (
+	"errors"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// SecretBytes holds secret material in a JSON document. Unlike a string, it
+// is encoded and decoded without intermediate copies and can be overwritten
+// with Wipe.
+type SecretBytes []byte
+
+// MarshalJSON encodes b as a JSON string.
+func (b SecretBytes) MarshalJSON() ([]byte, error) {
+	return appendJSONString(make([]byte, 0, len(b)+2), b), nil
+}
+
+// UnmarshalJSON decodes a JSON string into b.
+func (b *SecretBytes) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*b = nil
+		return nil
+	}
+	v, err := unquoteJSONString(data)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// Wipe overwrites b with zeros, such as a secret returned by GetBytes once the
+// caller is finished with it. It is a best effort: the Go runtime and
+// standard library may hold other copies of the data.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// appendFormValue appends a form-encoded name=value pair to dst, preceded by
+// "&" if dst is not empty. It escapes value as url.QueryEscape does but
+// without converting it to a string.
+func appendFormValue(dst []byte, name string, value []byte) []byte {
+	if len(dst) > 0 {
+		dst = append(dst, '&')
+	}
+	dst = appendQueryEscape(dst, []byte(name))
+	dst = append(dst, '=')
+	return appendQueryEscape(dst, value)
+}
+
+func appendQueryEscape(dst []byte, s []byte) []byte {
+	const hex = "0123456789ABCDEF"
+	for _, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			dst = append(dst, c)
+		case c == ' ':
+			dst = append(dst, '+')
+		default:
+			dst = append(dst, '%', hex[c>>4], hex[c&0xf])
+		}
+	}
+	return dst
+}
+
+// appendJSONString appends s to dst as a JSON string.
+func appendJSONString(dst []byte, s []byte) []byte {
+	const hex = "0123456789abcdef"
+	dst = append(dst, '"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			dst = append(dst, '\\', c)
+		case c == '\n':
+			dst = append(dst, '\\', 'n')
+		case c == '\r':
+			dst = append(dst, '\\', 'r')
+		case c == '\t':
+			dst = append(dst, '\\', 't')
+		case c < 0x20:
+			dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return append(dst, '"')
+}
+
+var errInvalidJSONString = errors.New("onetimesecret: invalid JSON string")
+
+// unquoteJSONString decodes a JSON string into a new byte slice.
+func unquoteJSONString(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return nil, errInvalidJSONString
+	}
+	data = data[1 : len(data)-1]
+
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+
+		i++
+		if i >= len(data) {
+			return nil, errInvalidJSONString
+		}
+		switch data[i] {
+		case '"', '\\', '/':
+			out = append(out, data[i])
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, ok := parseHex4(data[i+1:])
+			if !ok {
+				return nil, errInvalidJSONString
+			}
+			i += 4
+			if utf16.IsSurrogate(r) {
+				if i+6 < len(data) && data[i+1] == '\\' && data[i+2] == 'u' {
+					if r2, ok := parseHex4(data[i+3:]); ok {
+						if dec := utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+							r = dec
+							i += 6
+						}
+					}
+				}
+				if utf16.IsSurrogate(r) {
+					r = utf8.RuneError
+				}
+			}
+			var buf [utf8.UTFMax]byte
+			n := utf8.EncodeRune(buf[:], r)
+			out = append(out, buf[:n]...)
+		default:
+			return nil, errInvalidJSONString
+		}
+	}
+	return out, nil
+}
+
+func parseHex4(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[:4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c = c - '0'
+		case 'a' <= c && c <= 'f':
+			c = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r*16 + rune(c)
+	}
+	return r, true
+}
@@ -0,0 +1,79 @@
+package onetimesecret
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+var secretSamples = []string{
+	"",
+	"the launch codes",
+	"line 1\nline 2\r\n\ttabbed",
+	`quotes " and \ backslashes / slashes`,
+	"<html> & control \x00\x01\x1f",
+	"héllo wörld 日本語 🔑",
+}
+
+func TestSecretBytesJSON(t *testing.T) {
+	for _, s := range secretSamples {
+		want, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := SecretBytes(s).MarshalJSON()
+		if err != nil {
+			t.Fatalf("MarshalJSON(%q) failed: %v", s, err)
+		}
+		var roundTrip string
+		if err := json.Unmarshal(got, &roundTrip); err != nil || roundTrip != s {
+			t.Errorf("MarshalJSON(%q) = %s, which decodes to %q (err %v)", s, got, roundTrip, err)
+		}
+
+		var b SecretBytes
+		if err := json.Unmarshal(want, &b); err != nil {
+			t.Fatalf("UnmarshalJSON(%s) failed: %v", want, err)
+		}
+		if string(b) != s {
+			t.Errorf("UnmarshalJSON(%s) = %q (want %q)", want, b, s)
+		}
+	}
+}
+
+func TestAppendFormValue(t *testing.T) {
+	for _, s := range secretSamples {
+		got := appendFormValue(nil, "secret", []byte(s))
+		want := "secret=" + url.QueryEscape(s)
+		if string(got) != want {
+			t.Errorf("appendFormValue(%q) = %s (want %s)", s, got, want)
+		}
+	}
+}
+
+func TestWipe(t *testing.T) {
+	b := []byte("the launch codes")
+	Wipe(b)
+	if !bytes.Equal(b, make([]byte, len(b))) {
+		t.Errorf("Wipe left %q", b)
+	}
+}
+
+func TestPutBytesGetBytes(t *testing.T) {
+	for _, version := range []APIVersion{APIVersion1, APIVersion2} {
+		c, _ := newTestClient(t, WithAPIVersion(version))
+		for _, s := range secretSamples[1:] {
+			meta, err := c.PutBytes([]byte(s), "", 0, "")
+			if err != nil {
+				t.Fatalf("v%d: PutBytes failed: %v", version, err)
+			}
+			got, err := c.GetBytes(meta.SecretKey, "")
+			if err != nil {
+				t.Fatalf("v%d: GetBytes failed: %v", version, err)
+			}
+			if string(got) != s {
+				t.Errorf("v%d: got secret %q (want %q)", version, got, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package onetimesecret
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// chunkManifestPrefix marks the manifest secret stored by PutChunked. It is
+// followed by a JSON chunkManifest.
+const chunkManifestPrefix = "ots-chunked:v1:"
+
+// chunkKeySeparator separates the metadata keys in the metadata key of a
+// chunked secret.
+const chunkKeySeparator = "."
+
+// DefaultChunkSize is the chunk size PutChunked uses if Client.ChunkSize is
+// zero.
+const DefaultChunkSize = 64 * 1024
+
+// minChunkSize limits how far PutChunked shrinks chunks rejected by the
+// server.
+const minChunkSize = 1024
+
+// ErrIncomplete is returned by GetChunked when a chunk of a secret has already
+// been retrieved or burned. The remaining chunks have been destroyed.
+var ErrIncomplete = errors.New("onetimesecret: chunked secret is incomplete")
+
+// WithChunkSize sets the size in bytes of the chunks PutChunked splits large
+// secrets into. It should not exceed the server's size limit.
+func WithChunkSize(n int) Option {
+	return func(c *Client) {
+		c.ChunkSize = n
+	}
+}
+
+func (c *Client) chunkSize() int {
+	if c.ChunkSize <= 0 {
+		return DefaultChunkSize
+	}
+	return c.ChunkSize
+}
+
+// ChunkedMetadata describes a secret stored by PutChunked.
+type ChunkedMetadata struct {
+	// Metadata is the metadata of the secret to pass to GetChunked: the
+	// manifest listing the chunks if the secret was split, or the secret
+	// itself if it was not.
+	Metadata Metadata
+
+	// Chunks holds the metadata of each chunk in order. It is empty if the
+	// secret was not split.
+	Chunks []Metadata
+}
+
+// MetadataKey returns a key that identifies the manifest and all chunks, for
+// use with BurnChunked. If the secret was not split, it is the secret's
+// metadata key.
+func (m ChunkedMetadata) MetadataKey() string {
+	keys := []string{m.Metadata.MetadataKey}
+	for _, chunk := range m.Chunks {
+		keys = append(keys, chunk.MetadataKey)
+	}
+	return strings.Join(keys, chunkKeySeparator)
+}
+
+type chunkManifest struct {
+	Size   int      `json:"size"`
+	SHA256 string   `json:"sha256"`
+	Chunks []string `json:"chunks"`
+}
+
+// PutChunked stores a secret that may exceed the server's size limit. A
+// secret larger than the client's chunk size is split into chunks, each
+// stored as its own secret, and a manifest listing the chunks and the
+// secret's SHA-256 checksum is stored as another. If the server rejects a
+// chunk with ErrTooLarge, PutChunked retries with smaller chunks.
+//
+// Retrieve the secret with GetChunked and the secret key of the returned
+// metadata. Retrieving or burning any part of the secret invalidates the
+// whole: GetChunked then returns ErrIncomplete.
+func (c *Client) PutChunked(secret []byte, passphrase string, secretTTL int, recipient string) (ChunkedMetadata, error) {
+	return c.PutChunkedContext(context.Background(), secret, passphrase, secretTTL, recipient)
+}
+
+// PutChunkedContext is like PutChunked but uses ctx for the requests.
+func (c *Client) PutChunkedContext(ctx context.Context, secret []byte, passphrase string, secretTTL int, recipient string) (ChunkedMetadata, error) {
+	return c.PutChunkedWithOptions(ctx, secret, positionalOptions(passphrase, secretTTL, recipient))
+}
+
+// PutChunkedWithOptions is like PutChunkedContext but takes optional
+// parameters in a PutOptions. The options apply to the manifest and every
+// chunk, except Recipient, which is sent only with the manifest so that the
+// recipient is notified once.
+func (c *Client) PutChunkedWithOptions(ctx context.Context, secret []byte, opts PutOptions) (ChunkedMetadata, error) {
+	if len(secret) == 0 {
+		return ChunkedMetadata{}, ErrInvalid
+	}
+
+	// compress the whole secret rather than each chunk, so that compression
+	// can spare the need to split it
+	if c.Compress {
+		compressed, ok, err := c.compress(secret)
+		if err != nil {
+			return ChunkedMetadata{}, err
+		}
+		if ok {
+			defer Wipe(compressed)
+			secret = compressed
+		}
+	}
+
+	size := c.chunkSize()
+	if len(secret) <= size {
+		m, err := c.putBytes(ctx, secret, opts)
+		if !errors.Is(err, ErrTooLarge) {
+			return ChunkedMetadata{Metadata: m}, err
+		}
+		size = len(secret) / 2
+	}
+
+	chunkOpts := opts
+	chunkOpts.Recipient = ""
+	for {
+		chunks, err := c.putChunks(ctx, secret, size, chunkOpts)
+		if errors.Is(err, ErrTooLarge) && size/2 >= minChunkSize {
+			size /= 2
+			continue
+		}
+		if err != nil {
+			return ChunkedMetadata{}, err
+		}
+
+		manifest, err := newChunkManifest(secret, chunks)
+		if err != nil {
+			c.destroyChunks(chunks, opts.Passphrase)
+			return ChunkedMetadata{}, err
+		}
+		m, err := c.putBytes(ctx, manifest, opts)
+		Wipe(manifest)
+		if err != nil {
+			c.destroyChunks(chunks, opts.Passphrase)
+			return ChunkedMetadata{}, err
+		}
+		return ChunkedMetadata{Metadata: m, Chunks: chunks}, nil
+	}
+}
+
+// putChunks stores secret in chunks of at most size bytes. If a chunk cannot
+// be stored, it destroys the chunks already stored.
+func (c *Client) putChunks(ctx context.Context, secret []byte, size int, opts PutOptions) ([]Metadata, error) {
+	var chunks []Metadata
+	for len(secret) > 0 {
+		n := chunkLen(secret, size)
+		m, err := c.putBytes(ctx, secret[:n], opts)
+		if err != nil {
+			c.destroyChunks(chunks, opts.Passphrase)
+			return nil, err
+		}
+		chunks = append(chunks, m)
+		secret = secret[n:]
+	}
+	return chunks, nil
+}
+
+// destroyChunks makes a best effort to destroy stored chunks. It retrieves
+// rather than burns them, since anonymous clients cannot burn secrets, and
+// ignores the caller's context, which may be done.
+func (c *Client) destroyChunks(chunks []Metadata, passphrase string) {
+	for _, m := range chunks {
+		if b, err := c.getBytes(context.Background(), m.SecretKey, passphrase); err == nil {
+			Wipe(b)
+		}
+	}
+}
+
+// chunkLen returns the length of the next chunk of b. Where possible, chunks
+// end on UTF-8 character boundaries so that each chunk is valid text.
+func chunkLen(b []byte, size int) int {
+	if len(b) <= size {
+		return len(b)
+	}
+	for n := size; n > 0 && n > size-utf8.UTFMax; n-- {
+		if utf8.RuneStart(b[n]) {
+			return n
+		}
+	}
+	return size
+}
+
+func newChunkManifest(secret []byte, chunks []Metadata) ([]byte, error) {
+	sum := sha256.Sum256(secret)
+	manifest := chunkManifest{
+		Size:   len(secret),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+	for _, m := range chunks {
+		manifest.Chunks = append(manifest.Chunks, m.SecretKey)
+	}
+
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(chunkManifestPrefix), b...), nil
+}
+
+// IsChunked reports whether a secret retrieved with GetBytes is the manifest
+// of a secret stored in chunks by PutChunked.
+func IsChunked(secret []byte) bool {
+	return bytes.HasPrefix(secret, []byte(chunkManifestPrefix))
+}
+
+// GetChunked retrieves a secret stored by PutChunked given the secret key of
+// its metadata, reassembling the chunks if the secret was split. It returns
+// ErrIncomplete if a chunk has already been retrieved or burned and
+// ErrChecksum if the reassembled secret does not match the checksum in the
+// manifest. Every chunk is destroyed regardless. GetChunked also retrieves
+// secrets stored by Put.
+func (c *Client) GetChunked(secretKey string, passphrase string) ([]byte, error) {
+	return c.GetChunkedContext(context.Background(), secretKey, passphrase)
+}
+
+// GetChunkedContext is like GetChunked but uses ctx for the requests.
+func (c *Client) GetChunkedContext(ctx context.Context, secretKey string, passphrase string) ([]byte, error) {
+	secret, err := c.getBytes(ctx, secretKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if !IsChunked(secret) {
+		return c.decompress(secret)
+	}
+	defer Wipe(secret)
+
+	var manifest chunkManifest
+	if err := json.Unmarshal(secret[len(chunkManifestPrefix):], &manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %v", ErrIncomplete, err)
+	}
+	secret, err = c.getChunks(ctx, manifest, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return c.decompress(secret)
+}
+
+// getChunks retrieves and reassembles the chunks listed in a manifest. It
+// attempts to retrieve every chunk even if some are missing, so that none
+// outlive a failed retrieval.
+func (c *Client) getChunks(ctx context.Context, manifest chunkManifest, passphrase string) ([]byte, error) {
+	var firstErr error
+	chunks := make([][]byte, 0, len(manifest.Chunks))
+	size := 0
+	for _, key := range manifest.Chunks {
+		chunk, err := c.getBytes(ctx, key, passphrase)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		chunks = append(chunks, chunk)
+		size += len(chunk)
+	}
+	defer func() {
+		for _, chunk := range chunks {
+			Wipe(chunk)
+		}
+	}()
+
+	if errors.Is(firstErr, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrIncomplete, firstErr)
+	} else if firstErr != nil {
+		return nil, firstErr
+	}
+
+	secret := make([]byte, 0, size)
+	for _, chunk := range chunks {
+		secret = append(secret, chunk...)
+	}
+
+	sum := sha256.Sum256(secret)
+	want, err := hex.DecodeString(manifest.SHA256)
+	if err != nil || len(secret) != manifest.Size || subtle.ConstantTimeCompare(sum[:], want) != 1 {
+		Wipe(secret)
+		return nil, ErrChecksum
+	}
+	return secret, nil
+}
+
+// BurnChunked destroys a secret stored by PutChunked, including its manifest
+// and every chunk, given the metadata key returned by
+// ChunkedMetadata.MetadataKey. Parts that have already been destroyed are
+// skipped; BurnChunked returns ErrNotFound only if every part has been. It
+// returns the metadata of the parts it burned.
+func (c *Client) BurnChunked(metadataKey string, passphrase string) ([]Metadata, error) {
+	return c.BurnChunkedContext(context.Background(), metadataKey, passphrase)
+}
+
+// BurnChunkedContext is like BurnChunked but uses ctx for the requests.
+func (c *Client) BurnChunkedContext(ctx context.Context, metadataKey string, passphrase string) ([]Metadata, error) {
+	keys, err := ParseChunkedMetadataKey(metadataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var burned []Metadata
+	var firstErr error
+	for _, key := range keys {
+		m, err := c.BurnContext(ctx, key, passphrase)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		burned = append(burned, m)
+	}
+
+	if firstErr != nil {
+		return burned, firstErr
+	}
+	if len(burned) == 0 {
+		return nil, ErrNotFound
+	}
+	return burned, nil
+}
+
+// IsChunkedMetadataKey reports whether s is a metadata key returned by
+// ChunkedMetadata.MetadataKey for a secret that was split into chunks.
+func IsChunkedMetadataKey(s string) bool {
+	return strings.Contains(s, chunkKeySeparator) && !strings.ContainsAny(s, "/#?")
+}
+
+// ParseChunkedMetadataKey returns the metadata keys identified by s, a
+// metadata key returned by ChunkedMetadata.MetadataKey: the key of the
+// manifest followed by the key of each chunk. If s is the metadata key or URL
+// of a secret that was not split, it returns that key alone. It returns an
+// error wrapping ErrInvalid if s is malformed.
+func ParseChunkedMetadataKey(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if !IsChunkedMetadataKey(s) {
+		key, err := ParseMetadataURL(s)
+		if err != nil {
+			return nil, err
+		}
+		return []string{key}, nil
+	}
+
+	keys := strings.Split(s, chunkKeySeparator)
+	for _, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("%w: malformed chunked metadata key: %v", ErrInvalid, s)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,203 @@
+package onetimesecret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/corbaltcode/go-onetimesecret/otstest"
+)
+
+func TestPutTooLarge(t *testing.T) {
+	c, _ := newTestClientServer(t, []otstest.Option{otstest.WithMaxSecretSize(10)})
+	_, err := c.Put(strings.Repeat("x", 11), "", 0, "")
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got error %v (want %v)", err, ErrTooLarge)
+	}
+}
+
+func TestGetChunked(t *testing.T) {
+	c, srv := newTestClientServer(t, []otstest.Option{otstest.WithMaxSecretSize(2000)}, WithChunkSize(1000))
+	want := []byte(strings.Repeat("kubeconfig ", 500))
+	meta, err := c.PutChunked(want, "xyzzy", 0, "")
+	if err != nil {
+		t.Fatalf("put chunked failed: %v", err)
+	}
+	if len(meta.Chunks) != 6 {
+		t.Errorf("got %v chunks (want %v)", len(meta.Chunks), 6)
+	}
+
+	got, err := c.GetChunked(meta.Metadata.SecretKey, "xyzzy")
+	if err != nil {
+		t.Fatalf("get chunked failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got secret of %v bytes (want %v)", len(got), len(want))
+	}
+	for _, m := range meta.Chunks {
+		if _, ok := srv.Secret(m.SecretKey); ok {
+			t.Errorf("chunk %v not destroyed", m.SecretKey)
+		}
+	}
+}
+
+func TestGetChunkedSmall(t *testing.T) {
+	c, _ := newTestClient(t)
+	meta, err := c.PutChunked([]byte("small"), "", 0, "")
+	if err != nil {
+		t.Fatalf("put chunked failed: %v", err)
+	}
+	if len(meta.Chunks) != 0 {
+		t.Errorf("got %v chunks (want 0)", len(meta.Chunks))
+	}
+	if meta.MetadataKey() != meta.Metadata.MetadataKey {
+		t.Errorf("got metadata key %v (want %v)", meta.MetadataKey(), meta.Metadata.MetadataKey)
+	}
+	got, err := c.GetChunked(meta.Metadata.SecretKey, "")
+	if err != nil {
+		t.Fatalf("get chunked failed: %v", err)
+	}
+	if string(got) != "small" {
+		t.Errorf("got secret %v (want %v)", string(got), "small")
+	}
+}
+
+func TestPutChunkedShrinks(t *testing.T) {
+	c, srv := newTestClientServer(t, []otstest.Option{otstest.WithMaxSecretSize(3000)}, WithChunkSize(8000))
+	want := bytes.Repeat([]byte("é"), 2500)
+	meta, err := c.PutChunked(want, "", 0, "")
+	if err != nil {
+		t.Fatalf("put chunked failed: %v", err)
+	}
+	for _, m := range meta.Chunks {
+		chunk, ok := srv.Secret(m.SecretKey)
+		if !ok || !utf8.ValidString(chunk) {
+			t.Errorf("chunk %v is not valid UTF-8", m.SecretKey)
+		}
+	}
+	got, err := c.GetChunked(meta.Metadata.SecretKey, "")
+	if err != nil {
+		t.Fatalf("get chunked failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got secret of %v bytes (want %v)", len(got), len(want))
+	}
+}
+
+func TestPutChunkedRecipient(t *testing.T) {
+	c, _ := newTestClientServer(t, []otstest.Option{otstest.WithMaxSecretSize(2000)}, WithChunkSize(1000))
+	opts := PutOptions{Recipient: "foo@example.com"}
+	meta, err := c.PutChunkedWithOptions(context.Background(), bytes.Repeat([]byte("x"), 2500), opts)
+	if err != nil {
+		t.Fatalf("put chunked failed: %v", err)
+	}
+	if len(meta.Chunks) != 3 {
+		t.Errorf("got %v chunks (want %v)", len(meta.Chunks), 3)
+	}
+	if meta.Metadata.ObfuscatedRecipient == "" {
+		t.Error("manifest has no recipient")
+	}
+	for _, m := range meta.Chunks {
+		if m.ObfuscatedRecipient != "" {
+			t.Errorf("chunk %v has recipient %v (want none)", m.SecretKey, m.ObfuscatedRecipient)
+		}
+	}
+}
+
+func TestGetChunkedIncomplete(t *testing.T) {
+	c, srv := newTestClient(t, WithChunkSize(1000))
+	meta, err := c.PutChunked(bytes.Repeat([]byte("x"), 3000), "", 0, "")
+	if err != nil {
+		t.Fatalf("put chunked failed: %v", err)
+	}
+	if _, err := c.GetBytes(meta.Chunks[1].SecretKey, ""); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+
+	_, err = c.GetChunked(meta.Metadata.SecretKey, "")
+	if !errors.Is(err, ErrIncomplete) {
+		t.Errorf("got error %v (want %v)", err, ErrIncomplete)
+	}
+	for _, m := range meta.Chunks {
+		if _, ok := srv.Secret(m.SecretKey); ok {
+			t.Errorf("chunk %v not destroyed", m.SecretKey)
+		}
+	}
+}
+
+func TestBurnChunked(t *testing.T) {
+	c, srv := newTestClient(t, WithChunkSize(1000))
+	meta, err := c.PutChunked(bytes.Repeat([]byte("x"), 2500), "", 0, "")
+	if err != nil {
+		t.Fatalf("put chunked failed: %v", err)
+	}
+	if !IsChunkedMetadataKey(meta.MetadataKey()) {
+		t.Errorf("%v is not a chunked metadata key", meta.MetadataKey())
+	}
+
+	burned, err := c.BurnChunked(meta.MetadataKey(), "")
+	if err != nil {
+		t.Fatalf("burn chunked failed: %v", err)
+	}
+	if len(burned) != 4 {
+		t.Errorf("burned %v secrets (want %v)", len(burned), 4)
+	}
+	if _, ok := srv.Secret(meta.Metadata.SecretKey); ok {
+		t.Errorf("manifest not destroyed")
+	}
+	for _, m := range meta.Chunks {
+		if _, ok := srv.Secret(m.SecretKey); ok {
+			t.Errorf("chunk %v not destroyed", m.SecretKey)
+		}
+	}
+
+	if _, err := c.BurnChunked(meta.MetadataKey(), ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v (want %v)", err, ErrNotFound)
+	}
+}
+
+func TestParseChunkedMetadataKey(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"abc", []string{"abc"}},
+		{"abc.def.ghi", []string{"abc", "def", "ghi"}},
+		{" abc.def\n", []string{"abc", "def"}},
+		{"https://onetimesecret.com/private/abc", []string{"abc"}},
+		{"abc..def", nil},
+		{"abc.", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseChunkedMetadataKey(tt.s)
+		if tt.want == nil {
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("ParseChunkedMetadataKey(%q) returned error %v (want %v)", tt.s, err, ErrInvalid)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseChunkedMetadataKey(%q) failed: %v", tt.s, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseChunkedMetadataKey(%q) = %q (want %q)", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestChunkLen(t *testing.T) {
+	b := []byte("aé€")
+	for size := 1; size <= len(b); size++ {
+		n := chunkLen(b, size)
+		if n > size || n == 0 {
+			t.Errorf("chunkLen(%q, %v) = %v", b, size, n)
+		}
+		if !utf8.Valid(b[:n]) {
+			t.Errorf("chunkLen(%q, %v) = %v splits a character", b, size, n)
+		}
+	}
+}
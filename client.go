@@ -1,12 +1,16 @@
 package onetimesecret
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,10 +25,62 @@ var ErrInvalid = errors.New("onetimesecret: invalid argument")
 // key or secret key, or an incorrect passphrase is provided.
 var ErrNotFound = errors.New("onetimesecret: unknown secret")
 
-var baseURL url.URL
+// ErrUnauthorized is returned when the server rejects the client's username
+// or API key.
+var ErrUnauthorized = errors.New("onetimesecret: unauthorized")
+
+// ErrRateLimited is returned when the server refuses a request because the
+// client has sent too many requests.
+var ErrRateLimited = errors.New("onetimesecret: rate limited")
+
+// ErrServiceUnavailable is returned when the server is down or overloaded.
+var ErrServiceUnavailable = errors.New("onetimesecret: service unavailable")
+
+// ErrTooLarge is returned when a secret exceeds the server's size limit. Use
+// PutChunked to store larger secrets.
+var ErrTooLarge = errors.New("onetimesecret: secret too large")
+
+// An APIError describes an unsuccessful response from the server. Use
+// errors.Is to compare an APIError with ErrInvalid, ErrNotFound,
+// ErrUnauthorized, ErrRateLimited, ErrServiceUnavailable, or ErrTooLarge.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Message is the message sent by the server or, if the response is not
+	// JSON, the response body.
+	Message string
+	// Path is the API path of the request, such as "share", with any secret
+	// or metadata key replaced by "{key}", as in "private/{key}/burn", so
+	// that errors can be logged without revealing keys.
+	Path string
+	// RetryAfter is the delay requested by the server's Retry-After header,
+	// or zero if there was none.
+	RetryAfter time.Duration
+
+	err error
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("onetimesecret: %v: %v (status %v)", e.Path, msg, e.StatusCode)
+}
+
+// Unwrap returns the sentinel error corresponding to the response, if any.
+func (e *APIError) Unwrap() error {
+	return e.err
+}
+
+// maxErrorMessageLen limits how much of a non-JSON error body is kept in an
+// APIError.
+const maxErrorMessageLen = 512
+
+var defaultBaseURL url.URL
 
 func init() {
-	baseURL = url.URL{Scheme: "https", Host: "onetimesecret.com"}
+	defaultBaseURL = url.URL{Scheme: "https", Host: "onetimesecret.com"}
 }
 
 type SecretState string
@@ -57,6 +113,13 @@ type Metadata struct {
 	Created             time.Time
 	ObfuscatedRecipient string
 	HasPassphrase       bool
+
+	// ShareDomain is the custom domain of the secret's share URLs. It is only
+	// reported by APIVersion2.
+	ShareDomain string
+
+	baseURL url.URL
+	asOf    time.Time
 }
 
 // SecretURL returns a URL that allows retrieving the secret. If the secret has
@@ -65,7 +128,7 @@ func (m Metadata) SecretURL() (*url.URL, error) {
 	if m.SecretKey == "" {
 		return nil, ErrDestroyed
 	}
-	u := baseURL
+	u := m.shareBaseURL()
 	u.Path += "secret/" + url.PathEscape(m.SecretKey)
 	return &u, nil
 }
@@ -73,11 +136,24 @@ func (m Metadata) SecretURL() (*url.URL, error) {
 // MetadataURL returns a URL that allows retrieving the secret, burning the
 // secret, and viewing its metadata.
 func (m Metadata) MetadataURL() *url.URL {
-	u := baseURL
+	u := m.shareBaseURL()
 	u.Path += "private/" + url.PathEscape(m.MetadataKey)
 	return &u
 }
 
+// shareBaseURL returns the base URL of the secret's share domain or of the
+// server that created the secret or, if the metadata was not returned by a
+// Client, the default base URL.
+func (m Metadata) shareBaseURL() url.URL {
+	if m.ShareDomain != "" {
+		return url.URL{Scheme: "https", Host: m.ShareDomain}
+	}
+	if m.baseURL.Host == "" {
+		return defaultBaseURL
+	}
+	return m.baseURL
+}
+
 func (m *Metadata) fromKeyResponse(kr keyResponse) {
 	m.CustomerID = kr.CustomerID
 	m.MetadataKey = kr.MetadataKey
@@ -104,6 +180,12 @@ type PartialMetadata struct {
 	Updated            time.Time
 	Created            time.Time
 	Recipient          string
+
+	// ShareDomain is the custom domain of the secret's share URLs. It is only
+	// reported by APIVersion2.
+	ShareDomain string
+
+	asOf time.Time
 }
 
 func (m *PartialMetadata) fromKeyResponse(kr keyResponse) {
@@ -124,110 +206,398 @@ func (m *PartialMetadata) fromKeyResponse(kr keyResponse) {
 type Client struct {
 	Username string
 	Key      string
+
+	// Anonymous, if true, causes the client to send requests without
+	// credentials, ignoring Username and Key. Anonymous clients can store,
+	// generate, and retrieve secrets and get their metadata, but the server
+	// may refuse other requests with ErrUnauthorized.
+	Anonymous bool
+
+	// BaseURL is the root URL of the One-Time Secret server, for example
+	// "https://eu.onetimesecret.com" or the address of a self-hosted instance.
+	// If nil, the client uses https://onetimesecret.com.
+	BaseURL *url.URL
+
+	// HTTPClient is used to send requests. If nil, the client uses
+	// http.DefaultClient.
+	HTTPClient *http.Client
+
+	// UserAgent, if not empty, is sent in the User-Agent header of every
+	// request.
+	UserAgent string
+
+	// Timeout, if positive, limits the time each request may take, including
+	// reading the response.
+	Timeout time.Duration
+
+	// Retry, if not nil, causes the client to retry requests that fail
+	// transiently.
+	Retry *RetryPolicy
+
+	// APIVersion is the version of the API the client uses. If zero, the
+	// client uses APIVersion1.
+	APIVersion APIVersion
+
+	// ShareDomain, if not empty, is the custom domain of share URLs for
+	// secrets the client creates. It requires APIVersion2; with APIVersion1,
+	// creating a secret fails with an error wrapping ErrInvalid.
+	ShareDomain string
+
+	// DefaultTTL, if positive, is the TTL of secrets the client stores or
+	// generates when a call passes a TTL of zero. It is rounded up to whole
+	// seconds. If DefaultTTL is zero, the server chooses the TTL.
+	DefaultTTL time.Duration
+
+	// ChunkSize is the size in bytes of the chunks PutChunked splits large
+	// secrets into. If zero, the client uses DefaultChunkSize.
+	ChunkSize int
+
+	// Compress, if true, causes Put, PutChunked, and EncryptedPut to compress
+	// secrets when that makes them smaller. Compressed secrets are
+	// decompressed on retrieval regardless.
+	Compress bool
+
+	// MaxCompressionRatio limits how many times larger than a stored secret
+	// its decompressed contents may be, guarding against decompression bombs.
+	// If zero, the client uses DefaultMaxCompressionRatio.
+	MaxCompressionRatio int
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// baseURL returns a copy of the client's base URL whose path ends in a slash,
+// so that API and share paths can be appended to it.
+func (c *Client) baseURL() url.URL {
+	if c.BaseURL == nil {
+		return defaultBaseURL
+	}
+	u := *c.BaseURL
+	if u.Path != "" && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u
+}
+
+// newMetadata returns metadata for a key response whose share URLs point to
+// the client's server.
+func (c *Client) newMetadata(kr keyResponse) Metadata {
+	m := Metadata{baseURL: c.baseURL(), asOf: time.Now()}
+	m.fromKeyResponse(kr)
+	return m
 }
 
-// Get retrieves a secret given a secret key and, if necessary, a passphrase.
-// If there is no secret with the given secret key or the passphrase is
-// incorrect, Get returns ErrNotFound.
+// Get retrieves a secret given a secret key or secret URL and, if necessary, a
+// passphrase. If there is no secret with the given secret key or the
+// passphrase is incorrect, Get returns ErrNotFound. Secrets compressed by Put
+// are decompressed.
 func (c *Client) Get(secretKey string, passphrase string) (string, error) {
+	return c.GetContext(context.Background(), secretKey, passphrase)
+}
+
+// GetContext is like Get but uses ctx for the request.
+func (c *Client) GetContext(ctx context.Context, secretKey string, passphrase string) (string, error) {
+	b, err := c.GetBytesContext(ctx, secretKey, passphrase)
+	if err != nil {
+		return "", err
+	}
+	defer Wipe(b)
+	return string(b), nil
+}
+
+// GetBytes is like Get but returns the secret in a byte slice, which the
+// caller can overwrite when finished with it. The client makes a best effort
+// to overwrite its own copies of the secret.
+func (c *Client) GetBytes(secretKey string, passphrase string) ([]byte, error) {
+	return c.GetBytesContext(context.Background(), secretKey, passphrase)
+}
+
+// GetBytesContext is like GetBytes but uses ctx for the request.
+func (c *Client) GetBytesContext(ctx context.Context, secretKey string, passphrase string) ([]byte, error) {
+	secret, err := c.getBytes(ctx, secretKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return c.decompress(secret)
+}
+
+// getBytes retrieves a secret as stored, without decompressing it.
+func (c *Client) getBytes(ctx context.Context, secretKey string, passphrase string) ([]byte, error) {
+	secretKey, err := ParseSecretURL(secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.apiVersion() == APIVersion2 {
+		return c.getV2(ctx, secretKey, passphrase)
+	}
+
 	v := url.Values{}
 	v.Add("passphrase", passphrase)
 	path := "secret/" + url.PathEscape(secretKey)
 
 	var kr keyResponse
-	err := c.do("POST", path, v, nil, &kr)
+	err = c.do(ctx, "POST", path, v, nil, false, &kr)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	return kr.Value, nil
 }
 
+// PutOptions holds optional parameters of a new secret.
+type PutOptions struct {
+	// Passphrase, if not empty, is required to retrieve or burn the secret.
+	Passphrase string
+
+	// TTL is how long the secret lasts, rounded up to whole seconds. If zero,
+	// the client's DefaultTTL is used or, if that is also zero, the server
+	// chooses.
+	TTL time.Duration
+
+	// Recipient, if not empty, is an email address the server notifies of
+	// the secret.
+	Recipient string
+
+	// ShareDomain, if not empty, overrides the client's ShareDomain. Like
+	// the client's, it requires APIVersion2.
+	ShareDomain string
+}
+
+// GenerateOptions holds optional parameters of a generated secret. See
+// PutOptions.
+type GenerateOptions struct {
+	Passphrase  string
+	TTL         time.Duration
+	Recipient   string
+	ShareDomain string
+}
+
+// positionalOptions returns the options equivalent to the positional
+// parameters of Put.
+func positionalOptions(passphrase string, secretTTL int, recipient string) PutOptions {
+	return PutOptions{
+		Passphrase: passphrase,
+		TTL:        time.Duration(secretTTL) * time.Second,
+		Recipient:  recipient,
+	}
+}
+
+// errShareDomainV1 is returned when a secret is created with a share domain
+// using APIVersion1.
+var errShareDomainV1 = fmt.Errorf("%w: share domains require APIVersion2", ErrInvalid)
+
 // Put stores a secret with an optional passphrase and TTL in seconds and
 // returns the new secret's metadata. If the secret is empty, Put returns
-// ErrInvalid.
+// ErrInvalid. If the client's Compress field is true, the secret is
+// compressed when that makes it smaller. Put is equivalent to PutWithOptions
+// with the corresponding options.
 func (c *Client) Put(secret string, passphrase string, secretTTL int, recipient string) (Metadata, error) {
-	v := url.Values{}
-	v.Add("secret", secret)
-	v.Add("passphrase", passphrase)
-	v.Add("ttl", fmt.Sprint(secretTTL))
-	v.Add("recipient", recipient)
+	return c.PutContext(context.Background(), secret, passphrase, secretTTL, recipient)
+}
+
+// PutContext is like Put but uses ctx for the request.
+func (c *Client) PutContext(ctx context.Context, secret string, passphrase string, secretTTL int, recipient string) (Metadata, error) {
+	b := []byte(secret)
+	defer Wipe(b)
+	return c.PutBytesContext(ctx, b, passphrase, secretTTL, recipient)
+}
+
+// PutBytes is like Put but takes the secret in a byte slice, which the caller
+// can overwrite when PutBytes returns. The client makes a best effort to
+// overwrite its own copies of the secret.
+func (c *Client) PutBytes(secret []byte, passphrase string, secretTTL int, recipient string) (Metadata, error) {
+	return c.PutBytesContext(context.Background(), secret, passphrase, secretTTL, recipient)
+}
+
+// PutBytesContext is like PutBytes but uses ctx for the request.
+func (c *Client) PutBytesContext(ctx context.Context, secret []byte, passphrase string, secretTTL int, recipient string) (Metadata, error) {
+	return c.PutWithOptions(ctx, secret, positionalOptions(passphrase, secretTTL, recipient))
+}
+
+// PutWithOptions is like PutBytesContext but takes optional parameters in a
+// PutOptions.
+func (c *Client) PutWithOptions(ctx context.Context, secret []byte, opts PutOptions) (Metadata, error) {
+	if c.Compress {
+		compressed, ok, err := c.compress(secret)
+		if err != nil {
+			return Metadata{}, err
+		}
+		if ok {
+			defer Wipe(compressed)
+			secret = compressed
+		}
+	}
+	return c.putBytes(ctx, secret, opts)
+}
+
+// putBytes stores a secret as given, without compressing it.
+func (c *Client) putBytes(ctx context.Context, secret []byte, opts PutOptions) (Metadata, error) {
+	if c.apiVersion() == APIVersion2 {
+		return c.putV2(ctx, secret, opts)
+	}
+	if opts.ShareDomain != "" || c.ShareDomain != "" {
+		return Metadata{}, errShareDomainV1
+	}
+
+	// The secret is sent in the request body, which is built by hand so that
+	// it can be overwritten afterward.
+	var form []byte
+	form = appendFormValue(form, "secret", secret)
+	form = appendFormValue(form, "passphrase", []byte(opts.Passphrase))
+	form = appendFormValue(form, "ttl", []byte(fmt.Sprint(c.ttlSeconds(opts.TTL))))
+	form = appendFormValue(form, "recipient", []byte(opts.Recipient))
+	body := &requestBody{contentType: "application/x-www-form-urlencoded", data: form}
 
 	var kr keyResponse
-	err := c.do("POST", "share", v, nil, &kr)
+	err := c.do(ctx, "POST", "share", url.Values{}, body, false, &kr)
 	if err != nil {
 		return Metadata{}, err
 	}
 
-	m := Metadata{}
-	m.fromKeyResponse(kr)
-	return m, nil
+	return c.newMetadata(kr), nil
 }
 
 // Generate creates a short, unique secret with an optional passphrase and TTL,
-// returning the secret and its metadata.
+// returning the secret and its metadata. Generate is equivalent to
+// GenerateWithOptions with the corresponding options.
 func (c *Client) Generate(passphrase string, secretTTL int, recipient string) (string, Metadata, error) {
+	return c.GenerateContext(context.Background(), passphrase, secretTTL, recipient)
+}
+
+// GenerateContext is like Generate but uses ctx for the request.
+func (c *Client) GenerateContext(ctx context.Context, passphrase string, secretTTL int, recipient string) (string, Metadata, error) {
+	b, m, err := c.GenerateBytesContext(ctx, passphrase, secretTTL, recipient)
+	if err != nil {
+		return "", Metadata{}, err
+	}
+	defer Wipe(b)
+	return string(b), m, nil
+}
+
+// GenerateBytes is like Generate but returns the secret in a byte slice,
+// which the caller can overwrite when finished with it.
+func (c *Client) GenerateBytes(passphrase string, secretTTL int, recipient string) ([]byte, Metadata, error) {
+	return c.GenerateBytesContext(context.Background(), passphrase, secretTTL, recipient)
+}
+
+// GenerateBytesContext is like GenerateBytes but uses ctx for the request.
+func (c *Client) GenerateBytesContext(ctx context.Context, passphrase string, secretTTL int, recipient string) ([]byte, Metadata, error) {
+	return c.GenerateWithOptions(ctx, GenerateOptions{
+		Passphrase: passphrase,
+		TTL:        time.Duration(secretTTL) * time.Second,
+		Recipient:  recipient,
+	})
+}
+
+// GenerateWithOptions is like GenerateBytesContext but takes optional
+// parameters in a GenerateOptions.
+func (c *Client) GenerateWithOptions(ctx context.Context, opts GenerateOptions) ([]byte, Metadata, error) {
+	if c.apiVersion() == APIVersion2 {
+		return c.generateV2(ctx, opts)
+	}
+	if opts.ShareDomain != "" || c.ShareDomain != "" {
+		return nil, Metadata{}, errShareDomainV1
+	}
+
 	v := url.Values{}
-	v.Add("passphrase", passphrase)
-	v.Add("ttl", fmt.Sprint(secretTTL))
-	v.Add("recipient", recipient)
+	v.Add("passphrase", opts.Passphrase)
+	v.Add("ttl", fmt.Sprint(c.ttlSeconds(opts.TTL)))
+	v.Add("recipient", opts.Recipient)
 
 	var kr keyResponse
-	err := c.do("POST", "generate", v, nil, &kr)
+	err := c.do(ctx, "POST", "generate", v, nil, false, &kr)
 	if err != nil {
-		return "", Metadata{}, err
+		return nil, Metadata{}, err
 	}
 
-	m := Metadata{}
-	m.fromKeyResponse(kr)
-	return kr.Value, m, nil
+	return kr.Value, c.newMetadata(kr), nil
 }
 
-// Burn destroys a secret given its metadata key and, if necessary, passphrase.
-// If there is no secret with the given metadata key or the passphrase is
-// incorrect, Burn returns ErrNotFound.
+// Burn destroys a secret given its metadata key or metadata URL and, if
+// necessary, passphrase. If there is no secret with the given metadata key or
+// the passphrase is incorrect, Burn returns ErrNotFound.
 func (c *Client) Burn(metadataKey string, passphrase string) (Metadata, error) {
+	return c.BurnContext(context.Background(), metadataKey, passphrase)
+}
+
+// BurnContext is like Burn but uses ctx for the request.
+func (c *Client) BurnContext(ctx context.Context, metadataKey string, passphrase string) (Metadata, error) {
+	metadataKey, err := ParseMetadataURL(metadataKey)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	if c.apiVersion() == APIVersion2 {
+		return c.burnV2(ctx, metadataKey, passphrase)
+	}
+
 	v := url.Values{}
 	v.Add("passphrase", passphrase)
 
 	var br burnResponse
 	path := "private/" + url.PathEscape(metadataKey) + "/burn"
-	err := c.do("POST", path, v, nil, &br)
+	err = c.do(ctx, "POST", path, v, nil, false, &br)
 	if err != nil {
 		return Metadata{}, err
 	}
 
-	m := Metadata{}
-	m.fromKeyResponse(br.State)
-	return m, nil
+	return c.newMetadata(br.State), nil
 }
 
-// GetMetadata returns metadata for a secret given a metadata key. If there is
-// no secret with the given metadata key, GetMetadata returns ErrNotFound.
+// GetMetadata returns metadata for a secret given a metadata key or metadata
+// URL. If there is no secret with the given metadata key, GetMetadata returns
+// ErrNotFound.
 func (c *Client) GetMetadata(metadataKey string) (Metadata, error) {
+	return c.GetMetadataContext(context.Background(), metadataKey)
+}
+
+// GetMetadataContext is like GetMetadata but uses ctx for the request.
+func (c *Client) GetMetadataContext(ctx context.Context, metadataKey string) (Metadata, error) {
+	metadataKey, err := ParseMetadataURL(metadataKey)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	if c.apiVersion() == APIVersion2 {
+		return c.getMetadataV2(ctx, metadataKey)
+	}
+
 	var kr keyResponse
 	path := "private/" + url.PathEscape(metadataKey)
-	err := c.do("POST", path, url.Values{}, nil, &kr)
+	err = c.do(ctx, "POST", path, url.Values{}, nil, true, &kr)
 	if err != nil {
 		return Metadata{}, err
 	}
 
-	m := Metadata{}
-	m.fromKeyResponse(kr)
-	return m, nil
+	return c.newMetadata(kr), nil
 }
 
 // GetRecentMetadata returns partial metadata for recently created secrets.
 func (c *Client) GetRecentMetadata() ([]PartialMetadata, error) {
+	return c.GetRecentMetadataContext(context.Background())
+}
+
+// GetRecentMetadataContext is like GetRecentMetadata but uses ctx for the
+// request.
+func (c *Client) GetRecentMetadataContext(ctx context.Context) ([]PartialMetadata, error) {
+	if c.apiVersion() == APIVersion2 {
+		return c.getRecentMetadataV2(ctx)
+	}
+
 	var krs []keyResponse
-	err := c.do("GET", "private/recent", url.Values{}, nil, &krs)
+	err := c.do(ctx, "GET", "private/recent", url.Values{}, nil, true, &krs)
 	if err != nil {
 		return nil, err
 	}
 
 	ms := []PartialMetadata{}
 	for _, kr := range krs {
-		m := PartialMetadata{}
+		m := PartialMetadata{asOf: time.Now()}
 		m.fromKeyResponse(kr)
 		ms = append(ms, m)
 	}
@@ -237,49 +607,100 @@ func (c *Client) GetRecentMetadata() ([]PartialMetadata, error) {
 
 // GetSystemStatus returns the status of the One-Time Secret system.
 func (c *Client) GetSystemStatus() (SystemStatus, error) {
+	return c.GetSystemStatusContext(context.Background())
+}
+
+// GetSystemStatusContext is like GetSystemStatus but uses ctx for the request.
+func (c *Client) GetSystemStatusContext(ctx context.Context) (SystemStatus, error) {
+	if c.apiVersion() == APIVersion2 {
+		return c.getSystemStatusV2(ctx)
+	}
+
 	r := systemStatusResponse{}
-	err := c.do("GET", "status", url.Values{}, nil, &r)
+	err := c.do(ctx, "GET", "status", url.Values{}, nil, true, &r)
 	if err != nil {
 		return "", err
 	}
 	return parseSystemStatus(r.Status), nil
 }
 
-func (c *Client) do(method string, path string, query url.Values, body io.Reader, out interface{}) error {
-	u := baseURL
-	u.Path += "api/v1/" + path
-	req, err := http.NewRequest(method, u.String(), body)
+// requestBody is the body of an API request.
+type requestBody struct {
+	contentType string
+	data        []byte
+}
+
+// do sends a request to the API and decodes the response into out, retrying
+// according to the client's retry policy. Requests that are not idempotent are
+// only retried if the server cannot have processed them. The request body is
+// overwritten when do returns, since it may contain a secret.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body *requestBody, idempotent bool, out interface{}) error {
+	if body != nil {
+		defer Wipe(body.data)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := c.doOnce(ctx, method, path, query, body, out)
+		if err == nil {
+			return nil
+		}
+		delay, ok := c.Retry.next(attempt, err, idempotent)
+		if !ok {
+			return err
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// doOnce sends a single request. The request is bound to ctx, so canceling ctx
+// also aborts reading the response body.
+func (c *Client) doOnce(ctx context.Context, method string, path string, query url.Values, body *requestBody, out interface{}) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	u := c.baseURL()
+	u.Path += fmt.Sprintf("api/v%d/", c.apiVersion()) + path
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body.data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bodyReader)
 	if err != nil {
 		return err
 	}
 	req.URL.RawQuery = query.Encode()
-	req.SetBasicAuth(c.Username, c.Key)
+	if body != nil {
+		req.Header.Set("Content-Type", body.contentType)
+	}
+	if !c.Anonymous {
+		req.SetBasicAuth(c.Username, c.Key)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
 		return err
 	}
 
 	defer resp.Body.Close()
 	respBody, err := io.ReadAll(resp.Body)
+	defer Wipe(respBody)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		return err
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		var er errorResponse
-		err = json.Unmarshal(respBody, &er)
-		if err != nil {
-			return err
-		}
-		switch er.Message {
-		case "You did not provide anything to share":
-			return ErrInvalid
-		case "Unknown secret":
-			return ErrNotFound
-		default:
-			return fmt.Errorf("error: %v", er.Message)
-		}
+		return newAPIError(resp, path, respBody)
 	}
 
 	err = json.Unmarshal(respBody, out)
@@ -290,6 +711,79 @@ func (c *Client) do(method string, path string, query url.Values, body io.Reader
 	return nil
 }
 
+func newAPIError(resp *http.Response, path string, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Path:       redactPath(path),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+
+	var er errorResponse
+	if err := json.Unmarshal(body, &er); err == nil {
+		e.Message = er.Message
+	} else {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > maxErrorMessageLen {
+			msg = msg[:maxErrorMessageLen] + "..."
+		}
+		e.Message = msg
+	}
+
+	switch {
+	case e.Message == "You did not provide anything to share":
+		e.err = ErrInvalid
+	case e.Message == "Unknown secret":
+		e.err = ErrNotFound
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		e.err = ErrUnauthorized
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.err = ErrRateLimited
+	case resp.StatusCode == http.StatusRequestEntityTooLarge:
+		e.err = ErrTooLarge
+	case resp.StatusCode == http.StatusBadGateway ||
+		resp.StatusCode == http.StatusServiceUnavailable ||
+		resp.StatusCode == http.StatusGatewayTimeout:
+		e.err = ErrServiceUnavailable
+	}
+
+	return e
+}
+
+// redactPath replaces the secret or metadata key in an API path with "{key}".
+func redactPath(path string) string {
+	segments := strings.Split(path, "/")
+	if len(segments) < 2 || (segments[0] != "secret" && segments[0] != "private") {
+		return path
+	}
+	switch segments[1] {
+	case "conceal", "generate", "recent":
+		return path
+	}
+	segments[1] = "{key}"
+	return strings.Join(segments, "/")
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date. It returns zero if the value is empty or
+// invalid.
+func parseRetryAfter(s string, now time.Time) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(s); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
 func parseSecretState(s string) SecretState {
 	switch s {
 	case "burned":
@@ -326,18 +820,18 @@ type errorResponse struct {
 }
 
 type keyResponse struct {
-	CustomerID         string   `json:"custid"`
-	MetadataKey        string   `json:"metadata_key"`
-	SecretKey          string   `json:"secret_key"`
-	TTL                int      `json:"ttl"`
-	MetadataTTL        int      `json:"metadata_ttl"`
-	SecretTTL          int      `json:"secret_ttl"`
-	State              string   `json:"state"`
-	Updated            int      `json:"updated"`
-	Created            int      `json:"created"`
-	Recipient          []string `json:"recipient"`
-	Value              string   `json:"value"`
-	PassphraseRequired bool     `json:"passphrase_required"`
+	CustomerID         string      `json:"custid"`
+	MetadataKey        string      `json:"metadata_key"`
+	SecretKey          string      `json:"secret_key"`
+	TTL                int         `json:"ttl"`
+	MetadataTTL        int         `json:"metadata_ttl"`
+	SecretTTL          int         `json:"secret_ttl"`
+	State              string      `json:"state"`
+	Updated            int         `json:"updated"`
+	Created            int         `json:"created"`
+	Recipient          []string    `json:"recipient"`
+	Value              SecretBytes `json:"value"`
+	PassphraseRequired bool        `json:"passphrase_required"`
 }
 
 type systemStatusResponse struct {
@@ -1,21 +1,57 @@
 package onetimesecret
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/corbaltcode/go-onetimesecret/otstest"
 )
 
 var c Client
 
 const ttlAllowedError = 3
 
-func init() {
+func TestMain(m *testing.M) {
+	srv := otstest.NewServer()
+	base, err := url.Parse(srv.URL)
+	if err != nil {
+		panic(err)
+	}
 	c = Client{
-		Username: mustGetenv("OTS_USERNAME"),
-		Key:      mustGetenv("OTS_KEY"),
+		Username: "user@example.com",
+		Key:      "my-key",
+		BaseURL:  base,
+	}
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
+
+// newTestClient returns a client configured with opts and connected to a new
+// fake server.
+func newTestClient(t *testing.T, opts ...Option) (*Client, *otstest.Server) {
+	return newTestClientServer(t, nil, opts...)
+}
+
+// newTestClientServer is like newTestClient but configures the server with
+// serverOpts.
+func newTestClientServer(t *testing.T, serverOpts []otstest.Option, opts ...Option) (*Client, *otstest.Server) {
+	srv := otstest.NewServer(serverOpts...)
+	t.Cleanup(srv.Close)
+	base, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
 	}
+	opts = append([]Option{WithBaseURL(base)}, opts...)
+	return NewClient("user@example.com", "my-key", opts...), srv
 }
 
 func TestGet(t *testing.T) {
@@ -55,14 +91,14 @@ func TestGetWrongPassphrase(t *testing.T) {
 		t.Fatalf("put failed: %v", err)
 	}
 	_, err = c.Get(meta.SecretKey, "wrong")
-	if err != ErrNotFound {
+	if !errors.Is(err, ErrNotFound) {
 		t.Errorf("got error %v (want %v)", err, ErrNotFound)
 	}
 }
 
 func TestGetNonexistent(t *testing.T) {
 	_, err := c.Get(randStr(), "")
-	if err != ErrNotFound {
+	if !errors.Is(err, ErrNotFound) {
 		t.Errorf("got error %v (want %v)", err, ErrNotFound)
 	}
 }
@@ -97,7 +133,7 @@ func TestPut(t *testing.T) {
 
 func TestPutNothing(t *testing.T) {
 	_, err := c.Put("", "", 0, "")
-	if err != ErrInvalid {
+	if !errors.Is(err, ErrInvalid) {
 		t.Errorf("got error %v (want %v)", err, ErrInvalid)
 	}
 }
@@ -133,14 +169,341 @@ func TestGenerate(t *testing.T) {
 	}
 }
 
-func randStr() string {
-	return fmt.Sprint(rand.Int())
+func TestPutWithOptions(t *testing.T) {
+	passphrase := randStr()
+	meta, err := c.PutWithOptions(context.Background(), []byte("the launch codes"), PutOptions{
+		Passphrase: passphrase,
+		TTL:        90 * time.Minute,
+		Recipient:  "foo@example.com",
+	})
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if meta.InitialMetadataTTL != 5400 {
+		t.Errorf("wrong InitialMetadataTTL %v (want %v)", meta.InitialMetadataTTL, 5400)
+	}
+	if meta.ObfuscatedRecipient != "fo*****@e*****.com" {
+		t.Errorf("wrong Recipient %v (want %v)", meta.ObfuscatedRecipient, "fo*****@e*****.com")
+	}
+
+	secret, err := c.Get(meta.SecretKey, passphrase)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if secret != "the launch codes" {
+		t.Errorf("got secret %v (want %v)", secret, "the launch codes")
+	}
+}
+
+func TestGenerateWithOptions(t *testing.T) {
+	secret, meta, err := c.GenerateWithOptions(context.Background(), GenerateOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if meta.InitialMetadataTTL != 3600 {
+		t.Errorf("wrong InitialMetadataTTL %v (want %v)", meta.InitialMetadataTTL, 3600)
+	}
+	if meta.HasPassphrase {
+		t.Errorf("wrong HasPassphrase %v (want %v)", meta.HasPassphrase, false)
+	}
+
+	got, err := c.Get(meta.SecretKey, "")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got != string(secret) {
+		t.Errorf("got secret %v (want %v)", got, string(secret))
+	}
+}
+
+func TestShareDomainV1(t *testing.T) {
+	_, err := c.PutWithOptions(context.Background(), []byte(randStr()), PutOptions{ShareDomain: "eu.example.com"})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("put returned error %v (want %v)", err, ErrInvalid)
+	}
+	_, _, err = c.GenerateWithOptions(context.Background(), GenerateOptions{ShareDomain: "eu.example.com"})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("generate returned error %v (want %v)", err, ErrInvalid)
+	}
+
+	c, _ := newTestClient(t, WithShareDomain("secrets.example.com"))
+	if _, err := c.Put(randStr(), "", 0, ""); !errors.Is(err, ErrInvalid) {
+		t.Errorf("put with client share domain returned error %v (want %v)", err, ErrInvalid)
+	}
+}
+
+func TestShareURLsUseClientBaseURL(t *testing.T) {
+	base, err := url.Parse("https://ots.example.com/share")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Client{BaseURL: base}
+	meta := c.newMetadata(keyResponse{SecretKey: "abc", MetadataKey: "xyz"})
+
+	secretURL, err := meta.SecretURL()
+	if err != nil {
+		t.Fatalf("SecretURL failed: %v", err)
+	}
+	if got, want := secretURL.String(), "https://ots.example.com/share/secret/abc"; got != want {
+		t.Errorf("got secret URL %v (want %v)", got, want)
+	}
+	if got, want := meta.MetadataURL().String(), "https://ots.example.com/share/private/xyz"; got != want {
+		t.Errorf("got metadata URL %v (want %v)", got, want)
+	}
+}
+
+func TestShareURLsDefaultBaseURL(t *testing.T) {
+	meta := Metadata{SecretKey: "abc", MetadataKey: "xyz"}
+
+	secretURL, err := meta.SecretURL()
+	if err != nil {
+		t.Fatalf("SecretURL failed: %v", err)
+	}
+	if got, want := secretURL.String(), "https://onetimesecret.com/secret/abc"; got != want {
+		t.Errorf("got secret URL %v (want %v)", got, want)
+	}
+	if got, want := meta.MetadataURL().String(), "https://onetimesecret.com/private/xyz"; got != want {
+		t.Errorf("got metadata URL %v (want %v)", got, want)
+	}
 }
 
-func mustGetenv(key string) string {
-	val := os.Getenv(key)
-	if val == "" {
-		panic(fmt.Sprintf("missing env var: %v", key))
+func TestGetExpired(t *testing.T) {
+	c, srv := newTestClient(t)
+	meta, err := c.Put(randStr(), "", 60, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
 	}
-	return val
+	srv.Advance(61 * time.Second)
+	_, err = c.Get(meta.SecretKey, "")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v (want %v)", err, ErrNotFound)
+	}
+}
+
+func TestGetTwice(t *testing.T) {
+	meta, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if _, err := c.Get(meta.SecretKey, ""); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	_, err = c.Get(meta.SecretKey, "")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v (want %v)", err, ErrNotFound)
+	}
+	meta, err = c.GetMetadata(meta.MetadataKey)
+	if err != nil {
+		t.Fatalf("get metadata failed: %v", err)
+	}
+	if meta.State != SecretStateReceived {
+		t.Errorf("wrong State %v (want %v)", meta.State, SecretStateReceived)
+	}
+	if meta.SecretKey != "" {
+		t.Errorf("wrong SecretKey %v (want empty)", meta.SecretKey)
+	}
+}
+
+func TestBurn(t *testing.T) {
+	passphrase := randStr()
+	meta, err := c.Put(randStr(), passphrase, 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if _, err := c.Burn(meta.MetadataKey, "wrong"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v (want %v)", err, ErrNotFound)
+	}
+	burned, err := c.Burn(meta.MetadataKey, passphrase)
+	if err != nil {
+		t.Fatalf("burn failed: %v", err)
+	}
+	if burned.State != SecretStateBurned {
+		t.Errorf("wrong State %v (want %v)", burned.State, SecretStateBurned)
+	}
+	if _, err := c.Get(meta.SecretKey, passphrase); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v (want %v)", err, ErrNotFound)
+	}
+	if _, err := c.Burn(meta.MetadataKey, passphrase); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v (want %v)", err, ErrNotFound)
+	}
+}
+
+func TestGetMetadata(t *testing.T) {
+	put, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	meta, err := c.GetMetadata(put.MetadataKey)
+	if err != nil {
+		t.Fatalf("get metadata failed: %v", err)
+	}
+	if meta.SecretKey != put.SecretKey {
+		t.Errorf("wrong SecretKey %v (want %v)", meta.SecretKey, put.SecretKey)
+	}
+	if meta.State != SecretStateViewed {
+		t.Errorf("wrong State %v (want %v)", meta.State, SecretStateViewed)
+	}
+}
+
+func TestGetRecentMetadata(t *testing.T) {
+	c, _ := newTestClient(t)
+	put, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	metas, err := c.GetRecentMetadata()
+	if err != nil {
+		t.Fatalf("get recent metadata failed: %v", err)
+	}
+	if len(metas) != 1 || metas[0].MetadataKey != put.MetadataKey {
+		t.Errorf("got recent metadata %v (want metadata key %v)", metas, put.MetadataKey)
+	}
+}
+
+func TestGetSystemStatus(t *testing.T) {
+	c, srv := newTestClient(t)
+	status, err := c.GetSystemStatus()
+	if err != nil {
+		t.Fatalf("get system status failed: %v", err)
+	}
+	if status != SystemStatusNominal {
+		t.Errorf("got status %v (want %v)", status, SystemStatusNominal)
+	}
+	srv.SetStatus("offline")
+	status, err = c.GetSystemStatus()
+	if err != nil {
+		t.Fatalf("get system status failed: %v", err)
+	}
+	if status != SystemStatusOffline {
+		t.Errorf("got status %v (want %v)", status, SystemStatusOffline)
+	}
+}
+
+func TestAnonymous(t *testing.T) {
+	srv := otstest.NewServer(otstest.WithUser("user@example.com", "my-key"))
+	defer srv.Close()
+	base, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewAnonymousClient(WithBaseURL(base))
+	want := randStr()
+	meta, err := c.Put(want, "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if meta.CustomerID != "anon" {
+		t.Errorf("wrong CustomerID %v (want %v)", meta.CustomerID, "anon")
+	}
+	got, err := c.Get(meta.SecretKey, "")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("got secret %v (want %v)", got, want)
+	}
+	if _, err := c.GetMetadata(meta.MetadataKey); err != nil {
+		t.Errorf("get metadata failed: %v", err)
+	}
+	if _, err := c.GetRecentMetadata(); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("got error %v (want %v)", err, ErrUnauthorized)
+	}
+
+	// credentials are ignored in anonymous mode
+	c = NewClient("user@example.com", "wrong-key", WithBaseURL(base))
+	if _, err := c.Put(randStr(), "", 0, ""); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("got error %v (want %v)", err, ErrUnauthorized)
+	}
+	c.Anonymous = true
+	if _, err := c.Put(randStr(), "", 0, ""); err != nil {
+		t.Errorf("anonymous put failed: %v", err)
+	}
+}
+
+func TestGetContextCanceled(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.InjectFault(otstest.Fault{Delay: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.GetContext(ctx, randStr(), "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v (want %v)", err, context.DeadlineExceeded)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		fault      otstest.Fault
+		want       error
+		message    string
+		retryAfter time.Duration
+	}{
+		{otstest.Fault{StatusCode: http.StatusNotFound, Message: "Unknown secret"}, ErrNotFound, "Unknown secret", 0},
+		{otstest.Fault{StatusCode: http.StatusNotFound, Message: "You did not provide anything to share"}, ErrInvalid, "You did not provide anything to share", 0},
+		{otstest.Fault{StatusCode: http.StatusUnauthorized, Message: "Not authorized"}, ErrUnauthorized, "Not authorized", 0},
+		{otstest.Fault{StatusCode: http.StatusTooManyRequests, Message: "Cripes! You have been rate limited.", RetryAfter: "7"}, ErrRateLimited, "Cripes! You have been rate limited.", 7 * time.Second},
+		{otstest.Fault{StatusCode: http.StatusNotFound, Body: "<html>no such page</html>"}, nil, "<html>no such page</html>", 0},
+		{otstest.Fault{StatusCode: http.StatusServiceUnavailable, Body: "<html>down for maintenance</html>"}, ErrServiceUnavailable, "<html>down for maintenance</html>", 0},
+		{otstest.Fault{StatusCode: http.StatusInternalServerError, Body: " "}, nil, "", 0},
+	}
+
+	for _, tt := range tests {
+		c, srv := newTestClient(t)
+		srv.InjectFault(tt.fault)
+		_, err := c.GetMetadata("abc")
+		status := tt.fault.StatusCode
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("status %v: got error %v (want *APIError)", status, err)
+			continue
+		}
+		if apiErr.StatusCode != status {
+			t.Errorf("status %v: got StatusCode %v", status, apiErr.StatusCode)
+		}
+		if apiErr.Message != tt.message {
+			t.Errorf("status %v: got Message %q (want %q)", status, apiErr.Message, tt.message)
+		}
+		if apiErr.Path != "private/{key}" {
+			t.Errorf("status %v: got Path %v (want %v)", status, apiErr.Path, "private/{key}")
+		}
+		if strings.Contains(err.Error(), "abc") {
+			t.Errorf("status %v: error %q contains the metadata key", status, err)
+		}
+		if apiErr.RetryAfter != tt.retryAfter {
+			t.Errorf("status %v: got RetryAfter %v (want %v)", status, apiErr.RetryAfter, tt.retryAfter)
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("status %v: got error %v (want %v)", status, err, tt.want)
+		}
+		if tt.want == nil && apiErr.Unwrap() != nil {
+			t.Errorf("status %v: got wrapped error %v (want nil)", status, apiErr.Unwrap())
+		}
+	}
+}
+
+func TestRedactPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"share", "share"},
+		{"private/recent", "private/recent"},
+		{"secret/generate", "secret/generate"},
+		{"secret/abc", "secret/{key}"},
+		{"secret/abc/reveal", "secret/{key}/reveal"},
+		{"private/abc", "private/{key}"},
+		{"private/abc/burn", "private/{key}/burn"},
+	}
+	for _, tt := range tests {
+		if got := redactPath(tt.path); got != tt.want {
+			t.Errorf("redactPath(%q) = %q (want %q)", tt.path, got, tt.want)
+		}
+	}
+}
+
+func randStr() string {
+	return fmt.Sprint(rand.Int())
 }
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ots "github.com/corbaltcode/go-onetimesecret"
+)
+
+// generateSecret in the secret column of a batch manifest generates a secret.
+const generateSecret = "gen"
+
+var batchColumns = []string{"secret", "recipient", "passphrase", "ttl", "label"}
+
+var batchResultColumns = []string{"row", "label", "recipient", "secret", "secret_url", "metadata_key", "metadata_url", "secret_expires", "status", "error"}
+
+// batchRow is a row of a put-batch manifest. Rows are numbered from 1,
+// excluding any CSV header.
+type batchRow struct {
+	Row        int
+	Secret     string
+	Recipient  string
+	Passphrase string
+	TTL        time.Duration
+	Label      string
+}
+
+// batchResult is a row of a put-batch output manifest. Secret is set only for
+// generated secrets, which cannot otherwise be recovered.
+type batchResult struct {
+	Row           int    `json:"row"`
+	Label         string `json:"label"`
+	Recipient     string `json:"recipient"`
+	Secret        string `json:"secret"`
+	SecretURL     string `json:"secret_url"`
+	MetadataKey   string `json:"metadata_key"`
+	MetadataURL   string `json:"metadata_url"`
+	SecretExpires string `json:"secret_expires"`
+	Status        string `json:"status"`
+	Error         string `json:"error"`
+}
+
+type putBatchCmd struct {
+	output      string
+	concurrency int
+	rate        float64
+}
+
+func (c *putBatchCmd) AddFlags(flags *flag.FlagSet) {
+	flags.StringVar(&c.output, "o", "", "")
+	flags.IntVar(&c.concurrency, "concurrency", 4, "")
+	flags.Float64Var(&c.rate, "rate", 2, "")
+}
+
+func (c *putBatchCmd) Run(ctx cmdContext, args []string) error {
+	if len(args) < 1 {
+		return usageErr("missing arg: manifest")
+	} else if len(args) > 1 {
+		return usageErr("too many args")
+	}
+	if c.concurrency < 1 {
+		return usageErr("-concurrency must be at least 1")
+	}
+	if c.rate < 0 {
+		return usageErr("-rate must not be negative")
+	}
+
+	manifest := args[0]
+	output := c.output
+	if output == "" {
+		ext := filepath.Ext(manifest)
+		output = strings.TrimSuffix(manifest, ext) + ".out" + ext
+	}
+
+	rows, err := readBatchManifest(manifest)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := checkPassphrase(ctx, row.Passphrase); err != nil {
+			return fmt.Errorf("%v, row %v: %w", manifest, row.Row, err)
+		}
+	}
+
+	// resume from an earlier run, skipping rows that succeeded
+	results, err := readBatchResults(output)
+	if err != nil {
+		return err
+	}
+	done := map[int]batchResult{}
+	for _, r := range results {
+		if r.Row < 1 || r.Row > len(rows) || r.Label != rows[r.Row-1].Label || r.Recipient != rows[r.Row-1].Recipient {
+			return fmt.Errorf("%v does not match %v, row %v; remove it or choose another output with -o", output, manifest, r.Row)
+		}
+		if r.Status == "ok" {
+			done[r.Row] = r
+		}
+	}
+
+	results = make([]batchResult, len(rows))
+	var todo []int
+	for i, row := range rows {
+		if r, ok := done[row.Row]; ok {
+			results[i] = r
+		} else {
+			results[i] = batchResult{Row: row.Row, Label: row.Label, Recipient: row.Recipient, Status: "pending"}
+			todo = append(todo, i)
+		}
+	}
+
+	// creating many secrets may exceed the server's rate limit
+	if ctx.Client.Retry == nil {
+		ctx.Client.Retry = &ots.RetryPolicy{MaxAttempts: 5}
+	}
+
+	var tick <-chan time.Time
+	if c.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / c.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var mu sync.Mutex
+	var writeErr error
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				r := putBatchRow(ctx, rows[i], tick)
+
+				mu.Lock()
+				results[i] = r
+				// write after each row so that an interrupted run can resume
+				if err := writeBatchResults(output, results); err != nil && writeErr == nil {
+					writeErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, i := range todo {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if len(todo) == 0 {
+		if err := writeBatchResults(output, results); err != nil {
+			return err
+		}
+	} else if writeErr != nil {
+		return writeErr
+	}
+
+	var failed int
+	for _, r := range results {
+		if r.Status != "ok" {
+			failed++
+		}
+	}
+	printResult(results, ctx.JSON)
+	log.Printf("created %v, skipped %v (created earlier), failed %v; wrote %v\n", len(todo)-failed, len(done), failed, output)
+
+	if failed > 0 {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// putBatchRow stores or generates the secret of a manifest row.
+func putBatchRow(ctx cmdContext, row batchRow, tick <-chan time.Time) batchResult {
+	r := batchResult{Row: row.Row, Label: row.Label, Recipient: row.Recipient, Status: "failed"}
+
+	if tick != nil {
+		select {
+		case <-tick:
+		case <-ctx.Context.Done():
+			r.Error = ctx.Context.Err().Error()
+			return r
+		}
+	}
+
+	var meta ots.Metadata
+	var err error
+	if row.Secret == generateSecret {
+		opts := ots.GenerateOptions{Passphrase: row.Passphrase, TTL: row.TTL, Recipient: row.Recipient}
+		var secret []byte
+		secret, meta, err = ctx.Client.GenerateWithOptions(ctx.Context, opts)
+		r.Secret = string(secret)
+		ots.Wipe(secret)
+	} else {
+		opts := ots.PutOptions{Passphrase: row.Passphrase, TTL: row.TTL, Recipient: row.Recipient}
+		secret := []byte(row.Secret)
+		meta, err = ctx.Client.PutWithOptions(ctx.Context, secret, opts)
+		ots.Wipe(secret)
+	}
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+
+	secretURL, metadataURL := shareURLs(meta)
+	recordHistory(newHistoryEntry(ctx, meta, meta.MetadataKey, secretURL, metadataURL, row.Label))
+
+	r.SecretURL = secretURL
+	r.MetadataKey = meta.MetadataKey
+	r.MetadataURL = metadataURL
+	if t := meta.SecretExpiresAt(); !t.IsZero() {
+		r.SecretExpires = t.Format(time.RFC3339)
+	}
+	r.Status = "ok"
+	return r
+}
+
+// readBatchManifest reads and validates a put-batch manifest: a JSON array of
+// objects or, unless the path ends in ".json", a CSV file with a header row.
+func readBatchManifest(path string) ([]batchRow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ots.Wipe(data)
+
+	var records []map[string]string
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		records, err = parseBatchJSON(data)
+	} else {
+		records, err = parseBatchCSV(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest %v: %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("invalid manifest %v: no rows", path)
+	}
+
+	var rows []batchRow
+	for i, rec := range records {
+		row := batchRow{
+			Row:        i + 1,
+			Secret:     rec["secret"],
+			Recipient:  strings.TrimSpace(rec["recipient"]),
+			Passphrase: rec["passphrase"],
+			Label:      rec["label"],
+		}
+		if row.Secret == "" {
+			return nil, fmt.Errorf("invalid manifest %v, row %v: missing secret", path, row.Row)
+		}
+		if row.Recipient != "" {
+			if err := checkRecipient(row.Recipient); err != nil {
+				return nil, fmt.Errorf("invalid manifest %v, row %v: %w", path, row.Row, err)
+			}
+		}
+		if ttl := strings.TrimSpace(rec["ttl"]); ttl != "" {
+			if row.TTL, err = parseTTL(ttl); err != nil {
+				return nil, fmt.Errorf("invalid manifest %v, row %v: %w", path, row.Row, err)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseBatchCSV(data []byte) ([]map[string]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		if !contains(batchColumns, header[i]) {
+			return nil, fmt.Errorf("unknown column %q (want %v)", name, strings.Join(batchColumns, ", "))
+		}
+	}
+
+	var records []map[string]string
+	for {
+		fields, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		rec := map[string]string{}
+		for i, name := range header {
+			rec[name] = fields[i]
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func parseBatchJSON(data []byte) ([]map[string]string, error) {
+	var objs []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objs); err != nil {
+		return nil, err
+	}
+
+	var records []map[string]string
+	for i, obj := range objs {
+		rec := map[string]string{}
+		for name, raw := range obj {
+			if !contains(batchColumns, name) {
+				return nil, fmt.Errorf("row %v: unknown key %q (want %v)", i+1, name, strings.Join(batchColumns, ", "))
+			}
+			var s string
+			if err := json.Unmarshal(raw, &s); err == nil {
+				rec[name] = s
+				continue
+			}
+			// allow TTLs in seconds
+			var n int
+			if err := json.Unmarshal(raw, &n); err != nil || name != "ttl" {
+				return nil, fmt.Errorf("row %v: %v is not a string", i+1, name)
+			}
+			rec[name] = strconv.Itoa(n)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// readBatchResults reads an output manifest written by writeBatchResults. It
+// returns no results if the file does not exist.
+func readBatchResults(path string) ([]batchResult, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var results []batchResult
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(data, &results); err != nil {
+			return nil, fmt.Errorf("invalid output manifest %v: %w", path, err)
+		}
+		return results, nil
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid output manifest %v: %w", path, err)
+	}
+	for i, rec := range records {
+		if i == 0 {
+			continue
+		}
+		if len(rec) != len(batchResultColumns) {
+			return nil, fmt.Errorf("invalid output manifest %v, line %v", path, i+1)
+		}
+		row, err := strconv.Atoi(rec[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid output manifest %v, line %v: invalid row", path, i+1)
+		}
+		results = append(results, batchResult{
+			Row:           row,
+			Label:         rec[1],
+			Recipient:     rec[2],
+			Secret:        rec[3],
+			SecretURL:     rec[4],
+			MetadataKey:   rec[5],
+			MetadataURL:   rec[6],
+			SecretExpires: rec[7],
+			Status:        rec[8],
+			Error:         rec[9],
+		})
+	}
+	return results, nil
+}
+
+// writeBatchResults replaces the output manifest at path, writing JSON if path
+// ends in ".json" and CSV otherwise. The file holds secret URLs and generated
+// secrets, so it is readable only by the user.
+func writeBatchResults(path string, results []batchResult) error {
+	var buf bytes.Buffer
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		b, err := json.MarshalIndent(results, "", "\t")
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	} else {
+		w := csv.NewWriter(&buf)
+		w.Write(batchResultColumns)
+		for _, r := range results {
+			w.Write([]string{strconv.Itoa(r.Row), r.Label, r.Recipient, r.Secret, r.SecretURL, r.MetadataKey, r.MetadataURL, r.SecretExpires, r.Status, r.Error})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	}
+
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadBatchManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     []batchRow
+		err      string
+	}{
+		{
+			name:     "rows.csv",
+			manifest: "Secret, recipient ,ttl,label\nhunter2, foo@example.com ,7d,db\ngen,,3600,\n",
+			want: []batchRow{
+				{Row: 1, Secret: "hunter2", Recipient: "foo@example.com", TTL: 7 * 24 * time.Hour, Label: "db"},
+				{Row: 2, Secret: "gen", TTL: time.Hour},
+			},
+		},
+		{
+			name:     "rows.json",
+			manifest: `[{"secret": "hunter2", "ttl": "1h30m", "passphrase": "xyzzy"}, {"secret": "gen", "ttl": 60, "label": "api"}]`,
+			want: []batchRow{
+				{Row: 1, Secret: "hunter2", Passphrase: "xyzzy", TTL: 90 * time.Minute},
+				{Row: 2, Secret: "gen", TTL: time.Minute, Label: "api"},
+			},
+		},
+		{name: "unknown.csv", manifest: "secret,owner\nx,y\n", err: `unknown column "owner"`},
+		{name: "fields.csv", manifest: "secret,label\nx\n", err: "wrong number of fields"},
+		{name: "empty.csv", manifest: "secret,label\n", err: "no rows"},
+		{name: "secret.csv", manifest: "secret,label\n,db\n", err: "row 1: missing secret"},
+		{name: "recipient.csv", manifest: "secret,recipient\nx,foo@example.com\ny,foo\n", err: "row 2: invalid email address"},
+		{name: "ttl.csv", manifest: "secret,ttl\nx,1w\n", err: "row 1: invalid TTL"},
+		{name: "unknown.json", manifest: `[{"secret": "x", "owner": "y"}]`, err: `row 1: unknown key "owner"`},
+		{name: "number.json", manifest: `[{"secret": "x"}, {"secret": 1}]`, err: "row 2: secret is not a string"},
+		{name: "empty.json", manifest: `[]`, err: "no rows"},
+		{name: "object.json", manifest: `{"secret": "x"}`, err: "cannot unmarshal"},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.manifest), 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readBatchManifest(path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%v: got error %v (want %q)", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: read failed: %v", tt.name, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got rows %+v (want %+v)", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBatchResultsRoundTrip(t *testing.T) {
+	want := []batchResult{
+		{Row: 1, Label: "db", Recipient: "foo@example.com", Secret: "KbJ6GvqN3xTm", SecretURL: "https://onetimesecret.com/secret/abc", MetadataKey: "xyz", MetadataURL: "https://onetimesecret.com/private/xyz", SecretExpires: "2021-12-10T18:55:14Z", Status: "ok"},
+		{Row: 2, Label: "a, \"quoted\" label", Status: "failed", Error: "onetimesecret: unauthorized"},
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"out.csv", "out.json"} {
+		path := filepath.Join(dir, name)
+		if err := writeBatchResults(path, want); err != nil {
+			t.Fatalf("%v: write failed: %v", name, err)
+		}
+		got, err := readBatchResults(path)
+		if err != nil {
+			t.Fatalf("%v: read failed: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got results %+v (want %+v)", name, got, want)
+		}
+	}
+
+	got, err := readBatchResults(filepath.Join(dir, "missing.csv"))
+	if err != nil || got != nil {
+		t.Errorf("got results %+v and error %v for missing file (want none)", got, err)
+	}
+}
+
+func TestPutBatchResume(t *testing.T) {
+	ctx, srv := newTestContext(t)
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "rows.csv")
+	output := filepath.Join(dir, "rows.out.csv")
+	if err := os.WriteFile(manifest, []byte("secret,label\nx,one\ny,two\ngen,three\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	earlier := []batchResult{
+		{Row: 1, Label: "one", MetadataKey: "earlier", Status: "ok"},
+		{Row: 2, Label: "two", Status: "failed", Error: "timeout"},
+		{Row: 3, Label: "three", Status: "pending"},
+	}
+	if err := writeBatchResults(output, earlier); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &putBatchCmd{concurrency: 2}
+	if err := cmd.Run(ctx, []string{manifest}); err != nil {
+		t.Fatalf("put-batch failed: %v", err)
+	}
+
+	results, err := readBatchResults(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %v results (want 3)", len(results))
+	}
+	if results[0] != earlier[0] {
+		t.Errorf("row 1 was not skipped: got %+v (want %+v)", results[0], earlier[0])
+	}
+	for _, r := range results[1:] {
+		if r.Status != "ok" || r.MetadataKey == "" {
+			t.Errorf("row %v: got %+v (want ok)", r.Row, r)
+		}
+	}
+	if results[1].Secret != "" {
+		t.Errorf("row 2: got secret %q for a stored secret (want none)", results[1].Secret)
+	}
+	// the generated secret is recorded, since it appears nowhere else
+	secretKey := results[2].SecretURL[strings.LastIndex(results[2].SecretURL, "/")+1:]
+	if got, ok := srv.Secret(secretKey); !ok || results[2].Secret != got {
+		t.Errorf("row 3: got secret %q (want %q)", results[2].Secret, got)
+	}
+	if n := srv.Requests("share") + srv.Requests("generate"); n != 2 {
+		t.Errorf("created %v secrets (want 2)", n)
+	}
+}
+
+func TestPutBatchMismatchedOutput(t *testing.T) {
+	ctx, srv := newTestContext(t)
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "rows.json")
+	output := filepath.Join(dir, "rows.out.json")
+	if err := os.WriteFile(manifest, []byte(`[{"secret": "x", "label": "one"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeBatchResults(output, []batchResult{{Row: 1, Label: "other", Status: "ok"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &putBatchCmd{concurrency: 1}
+	if err := cmd.Run(ctx, []string{manifest}); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("got error %v (want mismatch)", err)
+	}
+	if n := srv.Requests("share"); n != 0 {
+		t.Errorf("created %v secrets (want none)", n)
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	ots "github.com/corbaltcode/go-onetimesecret"
+	"golang.org/x/term"
+)
+
+var relativeConfigPath = filepath.Join("ots", "config.toml")
+
+// defaultProfile names the settings at the top level of the config file.
+const defaultProfile = "default"
+
+const (
+	passphraseOptional = "optional"
+	passphraseRequired = "required"
+)
+
+var profileFields = []string{"username", "key", "key_file", "key_command", "url", "ttl", "passphrase"}
+
+// profile holds the settings for one account or server.
+type profile struct {
+	Username string `toml:"username,omitempty"`
+	Key      string `toml:"key,omitempty"`
+
+	// KeyFile and KeyCommand, if Key is not set, name a file holding the API
+	// key and a shell command that prints it, such as "pass show ots".
+	KeyFile    string `toml:"key_file,omitempty"`
+	KeyCommand string `toml:"key_command,omitempty"`
+
+	URL string `toml:"url,omitempty"`
+
+	// TTL is the default TTL of stored and generated secrets, such as "7d".
+	TTL string `toml:"ttl,omitempty"`
+
+	// Passphrase is the passphrase policy: "optional" (the default) or
+	// "required", which makes put, put-file, gen, and put-batch refuse to
+	// store a secret without a passphrase.
+	Passphrase string `toml:"passphrase,omitempty"`
+}
+
+// config is the contents of the config file. The top-level settings form the
+// default profile; others are in [profiles.<name>] sections.
+type config struct {
+	profile
+
+	// Profile is the profile used when none is specified with -profile or
+	// OTS_PROFILE.
+	Profile  string             `toml:"profile,omitempty"`
+	Profiles map[string]profile `toml:"profiles,omitempty"`
+}
+
+func getConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, relativeConfigPath), nil
+}
+
+func loadConfig() (config, error) {
+	path, err := getConfigPath()
+	if err != nil {
+		return config{}, err
+	}
+	var cfg config
+	_, err = toml.DecodeFile(path, &cfg)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return config{}, fmt.Errorf("invalid config file '%v': %w", path, err)
+	}
+	return cfg, nil
+}
+
+// warnIfConfigReadable warns if users other than the owner can read the config
+// file, which may hold API keys.
+func warnIfConfigReadable() {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	path, err := getConfigPath()
+	if err != nil {
+		return
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0044 != 0 {
+		log.Printf("warning: config file '%v' is readable by other users; run 'chmod 600 %v'\n", path, path)
+	}
+}
+
+// saveConfig replaces the config file with cfg. The file is readable only by
+// the user, since it holds API keys.
+func saveConfig(cfg config) error {
+	path, err := getConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".config-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	enc := toml.NewEncoder(f)
+	enc.Indent = ""
+	if err := enc.Encode(cfg); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// selectProfile returns the named profile. If name is empty, it returns the
+// profile chosen with "ots config use", or else the default profile.
+func (cfg config) selectProfile(name string) (string, profile, error) {
+	if name == "" {
+		name = cfg.Profile
+	}
+	if name == "" || name == defaultProfile {
+		return defaultProfile, cfg.profile, nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return name, profile{}, fmt.Errorf("unknown profile: %v", name)
+	}
+	return name, p, nil
+}
+
+func (cfg config) profileNames() []string {
+	names := []string{defaultProfile}
+	for name := range cfg.Profiles {
+		if name != defaultProfile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// getKey returns the profile's API key, reading it from KeyFile or running
+// KeyCommand if Key is not set.
+func (p profile) getKey() (string, error) {
+	switch {
+	case p.Key != "":
+		return p.Key, nil
+
+	case p.KeyFile != "":
+		path := p.KeyFile
+		if strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			path = filepath.Join(home, path[2:])
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("key_file: %w", err)
+		}
+		defer ots.Wipe(b)
+		key := string(bytes.TrimSpace(b))
+		if key == "" {
+			return "", fmt.Errorf("key_file: %v is empty", path)
+		}
+		return key, nil
+
+	case p.KeyCommand != "":
+		// leave stdin alone, since it may hold a secret to store
+		cmd := shellCommand(context.Background(), p.KeyCommand)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("key_command: %w", err)
+		}
+		defer ots.Wipe(out)
+		key := string(bytes.TrimSpace(out))
+		if key == "" {
+			return "", errors.New("key_command: printed no key")
+		}
+		return key, nil
+	}
+	return "", nil
+}
+
+// set sets a field of p after validating value. An empty value clears the
+// field.
+func (p *profile) set(field string, value string) error {
+	switch field {
+	case "username":
+		p.Username = value
+	case "key":
+		p.Key = value
+	case "key_file":
+		p.KeyFile = value
+	case "key_command":
+		p.KeyCommand = value
+	case "url":
+		if value != "" {
+			if _, err := parseBaseURL(value); err != nil {
+				return err
+			}
+		}
+		p.URL = value
+	case "ttl":
+		if value != "" {
+			if _, err := parseTTL(value); err != nil {
+				return err
+			}
+		}
+		p.TTL = value
+	case "passphrase":
+		if value != "" && value != passphraseOptional && value != passphraseRequired {
+			return fmt.Errorf("invalid passphrase policy %q (want %v or %v)", value, passphraseOptional, passphraseRequired)
+		}
+		p.Passphrase = value
+	default:
+		return usageErr(fmt.Sprintf("unknown field: %v (want %v)", field, strings.Join(profileFields, ", ")))
+	}
+	return nil
+}
+
+// maskKey hides all but the end of an API key.
+func maskKey(key string) string {
+	if len(key) < 12 {
+		return strings.Repeat("*", len(key))
+	}
+	return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
+
+// checkPassphrase enforces the selected profile's passphrase policy.
+func checkPassphrase(ctx cmdContext, passphrase string) error {
+	if ctx.RequirePassphrase && passphrase == "" {
+		return fmt.Errorf("profile %v requires a passphrase", ctx.Profile)
+	}
+	return nil
+}
+
+type configCmd struct{}
+
+func (c *configCmd) AddFlags(flags *flag.FlagSet) {}
+
+func (c *configCmd) Run(ctx cmdContext, args []string) error {
+	if len(args) < 1 {
+		return usageErr("missing arg: list, show, set, or use")
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) > 1 {
+			return usageErr("too many args")
+		}
+		type listing struct {
+			Name     string
+			Selected bool
+			Username string
+			URL      string
+		}
+		listings := []listing{}
+		for _, name := range cfg.profileNames() {
+			_, p, _ := cfg.selectProfile(name)
+			listings = append(listings, listing{Name: name, Selected: name == ctx.Profile, Username: p.Username, URL: p.URL})
+		}
+		printResult(listings, ctx.JSON)
+		return nil
+
+	case "show":
+		name := ctx.Profile
+		if len(args) > 2 {
+			return usageErr("too many args")
+		} else if len(args) == 2 {
+			name = args[1]
+		}
+		name, p, err := cfg.selectProfile(name)
+		if err != nil {
+			return err
+		}
+		passphrase := p.Passphrase
+		if passphrase == "" {
+			passphrase = passphraseOptional
+		}
+		printResult(struct {
+			Name       string
+			Username   string
+			Key        string
+			KeyFile    string
+			KeyCommand string
+			URL        string
+			TTL        string
+			Passphrase string
+		}{name, p.Username, maskKey(p.Key), p.KeyFile, p.KeyCommand, p.URL, p.TTL, passphrase}, ctx.JSON)
+		return nil
+
+	case "set":
+		if len(args) < 4 {
+			return usageErr("missing args: profile, field, and value")
+		} else if len(args) > 4 {
+			return usageErr("too many args")
+		}
+		name, field, value := args[1], args[2], args[3]
+		if field == "key" && value == stdinArg {
+			if err := readSecretShort(&value, "key"); err != nil {
+				return err
+			}
+		}
+
+		if name == defaultProfile {
+			if err := cfg.profile.set(field, value); err != nil {
+				return err
+			}
+		} else {
+			p := cfg.Profiles[name]
+			if err := p.set(field, value); err != nil {
+				return err
+			}
+			if cfg.Profiles == nil {
+				cfg.Profiles = map[string]profile{}
+			}
+			cfg.Profiles[name] = p
+		}
+		return saveConfig(cfg)
+
+	case "use":
+		if len(args) < 2 {
+			return usageErr("missing arg: profile")
+		} else if len(args) > 2 {
+			return usageErr("too many args")
+		}
+		name, _, err := cfg.selectProfile(args[1])
+		if err != nil {
+			return err
+		}
+		if name == defaultProfile {
+			name = ""
+		}
+		cfg.Profile = name
+		return saveConfig(cfg)
+
+	default:
+		return usageErr(fmt.Sprintf("unknown subcommand: %v", args[0]))
+	}
+}
+
+type loginCmd struct{}
+
+func (c *loginCmd) AddFlags(flags *flag.FlagSet) {}
+
+func (c *loginCmd) Run(ctx cmdContext, args []string) error {
+	if len(args) > 0 {
+		return usageErr("too many args")
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	p := cfg.profile
+	if ctx.Profile != defaultProfile {
+		p = cfg.Profiles[ctx.Profile]
+	}
+
+	client := ctx.Client
+	client.Anonymous = false
+	if client.BaseURL != nil {
+		p.URL = client.BaseURL.String()
+	} else if p.URL != "" {
+		if client.BaseURL, err = parseBaseURL(p.URL); err != nil {
+			return fmt.Errorf("invalid url in profile %v: %w", ctx.Profile, err)
+		}
+	}
+
+	// share one reader between prompts so that neither consumes the other's
+	// line when stdin is not a terminal
+	stdin := bufio.NewReader(os.Stdin)
+	isTerminal := term.IsTerminal(int(os.Stdin.Fd()))
+	if client.Username == "" {
+		if isTerminal {
+			if p.Username != "" {
+				fmt.Printf("username [%v]: ", p.Username)
+			} else {
+				fmt.Print("username: ")
+			}
+		}
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("reading username: %w", err)
+		}
+		client.Username = strings.TrimSpace(line)
+		if client.Username == "" {
+			client.Username = p.Username
+		}
+	}
+	if client.Key == "" {
+		if isTerminal {
+			b, err := readSecretFromTerminal("API key")
+			if err != nil {
+				return err
+			}
+			client.Key = string(bytes.TrimSpace(b))
+			ots.Wipe(b)
+		} else {
+			line, err := stdin.ReadString('\n')
+			if err != nil && line == "" {
+				return fmt.Errorf("reading key: %w", err)
+			}
+			client.Key = strings.TrimSpace(line)
+		}
+	}
+	if client.Username == "" {
+		return errors.New("missing username")
+	} else if client.Key == "" {
+		return errors.New("missing key")
+	}
+
+	if _, err := client.GetRecentMetadataContext(ctx.Context); errors.Is(err, ots.ErrUnauthorized) {
+		return fmt.Errorf("the server rejected username %v and the key", client.Username)
+	} else if err != nil {
+		return fmt.Errorf("cannot verify credentials: %w", err)
+	}
+
+	p.Username = client.Username
+	p.Key = client.Key
+	p.KeyFile = ""
+	p.KeyCommand = ""
+	if ctx.Profile == defaultProfile {
+		cfg.profile = p
+	} else {
+		if cfg.Profiles == nil {
+			cfg.Profiles = map[string]profile{}
+		}
+		cfg.Profiles[ctx.Profile] = p
+	}
+	if err := saveConfig(cfg); err != nil {
+		return err
+	}
+
+	path, _ := getConfigPath()
+	log.Printf("saved credentials for %v to profile %v in %v\n", client.Username, ctx.Profile, path)
+	return nil
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	ots "github.com/corbaltcode/go-onetimesecret"
+	"github.com/corbaltcode/go-onetimesecret/otstest"
+)
+
+// setConfigHome keeps the config file in a temporary directory for the rest
+// of the test and returns its path.
+func setConfigHome(t *testing.T) string {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path, err := getConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSelectProfile(t *testing.T) {
+	cfg := config{
+		profile: profile{Username: "me@example.com"},
+		Profile: "work",
+		Profiles: map[string]profile{
+			"work": {Username: "me@work.example.com"},
+			"eu":   {URL: "https://eu.onetimesecret.com"},
+		},
+	}
+	tests := []struct {
+		cfg      config
+		name     string
+		wantName string
+		want     profile
+		ok       bool
+	}{
+		{cfg, "", "work", cfg.Profiles["work"], true},
+		{cfg, "default", "default", cfg.profile, true},
+		{cfg, "eu", "eu", cfg.Profiles["eu"], true},
+		{cfg, "missing", "missing", profile{}, false},
+		{config{profile: cfg.profile}, "", "default", cfg.profile, true},
+		{config{Profile: "missing"}, "", "missing", profile{}, false},
+	}
+	for _, tt := range tests {
+		name, p, err := tt.cfg.selectProfile(tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("selectProfile(%q) returned error %v (want ok %v)", tt.name, err, tt.ok)
+		}
+		if name != tt.wantName || p != tt.want {
+			t.Errorf("selectProfile(%q) = %q, %+v (want %q, %+v)", tt.name, name, p, tt.wantName, tt.want)
+		}
+	}
+
+	if got, want := cfg.profileNames(), []string{"default", "eu", "work"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("profileNames() = %q (want %q)", got, want)
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	path := setConfigHome(t)
+	want := config{
+		profile: profile{Username: "me@example.com", KeyFile: "~/.ots-key", TTL: "7d"},
+		Profile: "work",
+		Profiles: map[string]profile{
+			"work": {Username: "me@work.example.com", KeyCommand: "pass show ots", URL: "https://ots.work.example.com", Passphrase: passphraseRequired},
+		},
+	}
+	if err := saveConfig(want); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the default profile is at the top level, not in a section of its own
+	for _, line := range []string{`username = "me@example.com"`, `profile = "work"`, "[profiles.work]"} {
+		if !strings.Contains(string(data), line+"\n") {
+			t.Errorf("config file does not contain %q:\n%s", line, data)
+		}
+	}
+	if strings.Contains(string(data), "[profile]") || strings.Contains(string(data), "[profiles.default]") {
+		t.Errorf("config file has a section for the default profile:\n%s", data)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("config file has permissions %v (want %v)", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	got, err := loadConfig()
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %+v (want %+v)", got, want)
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	setConfigHome(t)
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, config{}) {
+		t.Errorf("loaded %+v (want empty config)", cfg)
+	}
+}
+
+func TestConfigSetUse(t *testing.T) {
+	setConfigHome(t)
+	ctx := cmdContext{Profile: defaultProfile}
+	cmd := &configCmd{}
+	run := func(args ...string) error {
+		return cmd.Run(ctx, args)
+	}
+
+	for _, args := range [][]string{
+		{"set", "default", "username", "me@example.com"},
+		{"set", "default", "ttl", "7d"},
+		{"set", "work", "username", "me@work.example.com"},
+		{"set", "work", "url", "https://ots.work.example.com"},
+		{"set", "work", "passphrase", "required"},
+		{"use", "work"},
+	} {
+		if err := run(args...); err != nil {
+			t.Fatalf("config %v failed: %v", strings.Join(args, " "), err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"set", "work", "ttl", "1w"},
+		{"set", "work", "url", "ftp://ots.example.com"},
+		{"set", "work", "passphrase", "sometimes"},
+		{"set", "work", "color", "blue"},
+		{"use", "missing"},
+		{"frobnicate"},
+	} {
+		if err := run(args...); err == nil {
+			t.Errorf("config %v succeeded (want error)", strings.Join(args, " "))
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	want := config{
+		profile: profile{Username: "me@example.com", TTL: "7d"},
+		Profile: "work",
+		Profiles: map[string]profile{
+			"work": {Username: "me@work.example.com", URL: "https://ots.work.example.com", Passphrase: passphraseRequired},
+		},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got config %+v (want %+v)", cfg, want)
+	}
+
+	// clearing a field and choosing the default profile again
+	if err := run("set", "work", "url", ""); err != nil {
+		t.Fatalf("config set failed: %v", err)
+	}
+	if err := run("use", "default"); err != nil {
+		t.Fatalf("config use failed: %v", err)
+	}
+	cfg, err = loadConfig()
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if cfg.Profile != "" || cfg.Profiles["work"].URL != "" {
+		t.Errorf("got profile %q and work url %q (want both empty)", cfg.Profile, cfg.Profiles["work"].URL)
+	}
+}
+
+func TestCheckPassphrase(t *testing.T) {
+	ctx := cmdContext{Profile: "work", RequirePassphrase: true}
+	if err := checkPassphrase(ctx, ""); err == nil {
+		t.Error("missing passphrase allowed by required policy")
+	}
+	if err := checkPassphrase(ctx, "xyzzy"); err != nil {
+		t.Errorf("passphrase refused: %v", err)
+	}
+	if err := checkPassphrase(cmdContext{Profile: defaultProfile}, ""); err != nil {
+		t.Errorf("missing passphrase refused by optional policy: %v", err)
+	}
+}
+
+func TestGetKey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("key commands are written for a Unix shell")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.WriteFile(filepath.Join(home, ".ots-key"), []byte("file-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "empty"), []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		p    profile
+		want string
+		ok   bool
+	}{
+		{profile{}, "", true},
+		{profile{Key: "inline-key", KeyFile: "~/.ots-key", KeyCommand: "echo command-key"}, "inline-key", true},
+		{profile{KeyFile: "~/.ots-key", KeyCommand: "echo command-key"}, "file-key", true},
+		{profile{KeyFile: filepath.Join(home, ".ots-key")}, "file-key", true},
+		{profile{KeyCommand: "echo command-key"}, "command-key", true},
+		{profile{KeyFile: "~/missing"}, "", false},
+		{profile{KeyFile: "~/empty"}, "", false},
+		{profile{KeyCommand: "exit 1"}, "", false},
+		{profile{KeyCommand: "echo"}, "", false},
+	}
+	for _, tt := range tests {
+		got, err := tt.p.getKey()
+		if (err == nil) != tt.ok {
+			t.Errorf("getKey() of %+v returned error %v (want ok %v)", tt.p, err, tt.ok)
+		} else if got != tt.want {
+			t.Errorf("getKey() of %+v = %q (want %q)", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestConfigureClientKey(t *testing.T) {
+	burn, err := findCmdType("burn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof := profile{Username: "me@example.com", Key: "profile-key"}
+
+	tests := []struct {
+		flag string
+		env  string
+		want string
+	}{
+		{"", "", "profile-key"},
+		{"", "env-key", "env-key"},
+		{"flag-key", "env-key", "flag-key"},
+	}
+	for _, tt := range tests {
+		t.Setenv("OTS_USERNAME", "")
+		t.Setenv("OTS_KEY", tt.env)
+		ctx := cmdContext{Client: &ots.Client{Key: tt.flag}, Profile: defaultProfile}
+		configureClient(&ctx, burn, prof)
+		if ctx.Client.Key != tt.want || ctx.Client.Username != prof.Username {
+			t.Errorf("with flag %q and env %q: got username %q and key %q (want %q and %q)", tt.flag, tt.env, ctx.Client.Username, ctx.Client.Key, prof.Username, tt.want)
+		}
+	}
+}
+
+func TestConfigureClientAnonymous(t *testing.T) {
+	t.Setenv("OTS_USERNAME", "")
+	t.Setenv("OTS_KEY", "")
+	for _, name := range []string{"get", "meta", "notify", "watch"} {
+		cmdType, err := findCmdType(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := cmdContext{Client: &ots.Client{}, Profile: defaultProfile}
+		configureClient(&ctx, cmdType, profile{})
+		if !ctx.Client.Anonymous {
+			t.Errorf("%v without credentials is not anonymous", name)
+		}
+	}
+}
+
+// setStdin replaces stdin with a pipe holding input for the rest of the test.
+func setStdin(t *testing.T, input string) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		w.WriteString(input)
+		w.Close()
+	}()
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+}
+
+func TestLogin(t *testing.T) {
+	ctx, srv := newTestContext(t, otstest.WithUser("user@example.com", "my-key"))
+	ctx.Client.Username = ""
+	ctx.Client.Key = ""
+	if err := saveConfig(config{profile: profile{KeyFile: "~/.ots-key", TTL: "7d"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	setStdin(t, "user@example.com\nmy-key\n")
+	if err := (&loginCmd{}).Run(ctx, nil); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := profile{Username: "user@example.com", Key: "my-key", URL: srv.URL, TTL: "7d"}
+	if cfg.profile != want {
+		t.Errorf("saved profile %+v (want %+v)", cfg.profile, want)
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	ctx, _ := newTestContext(t, otstest.WithUser("user@example.com", "my-key"))
+	ctx.Client.Username = ""
+	ctx.Client.Key = ""
+	ctx.Profile = "work"
+
+	setStdin(t, "user@example.com\nwrong-key\n")
+	if err := (&loginCmd{}).Run(ctx, nil); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("got error %v (want rejected)", err)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Profiles["work"]; ok {
+		t.Errorf("saved profile %+v for rejected credentials", cfg.Profiles["work"])
+	}
+}
+
+func TestWarnIfConfigReadable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not checked on Windows")
+	}
+	path := setConfigHome(t)
+	if err := saveConfig(config{profile: profile{Key: "my-key"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	warnIfConfigReadable()
+	if buf.Len() != 0 {
+		t.Errorf("warned about a private config file: %v", buf.String())
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	warnIfConfigReadable()
+	if !strings.Contains(buf.String(), "readable by other users") {
+		t.Errorf("did not warn about a readable config file; logged %q", buf.String())
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ots "github.com/corbaltcode/go-onetimesecret"
+)
+
+var relativeHistoryPath = filepath.Join("ots", "history.jsonl")
+
+// historyEntry records a secret created by put, put-file, or gen. The history
+// file holds one JSON-encoded entry per line.
+type historyEntry struct {
+	Created     time.Time
+	Label       string
+	MetadataKey string
+	MetadataURL string
+
+	// SecretURL omits the decryption key of end-to-end encrypted secrets.
+	SecretURL string
+
+	TTL             int
+	SecretExpires   time.Time
+	MetadataExpires time.Time
+	Recipient       string
+
+	// Profile is the config profile the secret was created with. Entries
+	// recorded before profiles existed have none and belong to the default
+	// profile.
+	Profile string
+
+	// Server is the base URL of the server the secret was created on, or
+	// empty for onetimesecret.com.
+	Server string
+}
+
+func newHistoryEntry(ctx cmdContext, meta ots.Metadata, metadataKey string, secretURL string, metadataURL string, label string) historyEntry {
+	if u, err := url.Parse(secretURL); err == nil && u.Fragment != "" {
+		u.Fragment = ""
+		secretURL = u.String()
+	}
+	return historyEntry{
+		Created:         time.Now().Round(time.Second),
+		Label:           label,
+		MetadataKey:     metadataKey,
+		MetadataURL:     metadataURL,
+		SecretURL:       secretURL,
+		TTL:             meta.InitialMetadataTTL,
+		SecretExpires:   meta.SecretExpiresAt(),
+		MetadataExpires: meta.MetadataExpiresAt(),
+		Recipient:       meta.ObfuscatedRecipient,
+		Profile:         ctx.Profile,
+		Server:          historyServer(ctx.Client),
+	}
+}
+
+// historyServer returns the Server of history entries for secrets created by
+// client.
+func historyServer(client *ots.Client) string {
+	if client.BaseURL == nil {
+		return ""
+	}
+	return strings.TrimSuffix(client.BaseURL.String(), "/")
+}
+
+// inContext reports whether e was created with the profile and server of
+// ctx. Commands that act on the history consider only such entries, since
+// other servers don't know the secrets of e.
+func (e historyEntry) inContext(ctx cmdContext) bool {
+	profile := e.Profile
+	if profile == "" {
+		profile = defaultProfile
+	}
+	return profile == ctx.Profile && e.Server == historyServer(ctx.Client)
+}
+
+func getHistoryPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, relativeHistoryPath), nil
+}
+
+// recordHistory appends entries to the history file, warning rather than
+// failing if it cannot, since the secrets have already been created.
+func recordHistory(entries ...historyEntry) {
+	if err := appendHistory(entries); err != nil {
+		log.Printf("warning: cannot record history: %v\n", err)
+	}
+}
+
+// appendHistory appends entries to the history file, which it creates, along
+// with its directory, readable only by the user.
+func appendHistory(entries []historyEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	path, err := getHistoryPath()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if info, err := f.Stat(); err == nil && info.Mode().Perm() != 0600 {
+		f.Chmod(0600)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadHistory returns the entries in the history file, oldest first.
+func loadHistory() ([]historyEntry, error) {
+	path, err := getHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []historyEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []historyEntry{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid history file '%v', line %v: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// writeHistory replaces the history file with entries.
+func writeHistory(entries []historyEntry) error {
+	path, err := getHistoryPath()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".history-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+type historyCmd struct {
+	label       string
+	since       ttlValue
+	expired     bool
+	prune       bool
+	allProfiles bool
+}
+
+func (c *historyCmd) AddFlags(flags *flag.FlagSet) {
+	flags.StringVar(&c.label, "label", "", "")
+	flags.Var(&c.since, "since", "")
+	flags.BoolVar(&c.expired, "expired", false, "")
+	flags.BoolVar(&c.prune, "prune", false, "")
+	flags.BoolVar(&c.allProfiles, "all-profiles", false, "")
+}
+
+func (c *historyCmd) Run(ctx cmdContext, args []string) error {
+	if len(args) > 0 {
+		return usageErr("too many args")
+	}
+	if c.label != "" {
+		if _, err := path.Match(c.label, ""); err != nil {
+			return usageErr(fmt.Sprintf("invalid label pattern: %v", c.label))
+		}
+	}
+	if c.prune && c.label == "" && c.since == 0 && !c.expired {
+		return usageErr("-prune requires -label, -since, or -expired")
+	}
+
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	matched := []historyEntry{}
+	var kept []historyEntry
+	for _, e := range entries {
+		if (c.allProfiles || e.inContext(ctx)) && c.matches(e, now) {
+			matched = append(matched, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+
+	if c.prune && len(matched) > 0 {
+		if err := writeHistory(kept); err != nil {
+			return err
+		}
+	}
+
+	printResult(matched, ctx.JSON)
+	return nil
+}
+
+func (c *historyCmd) matches(e historyEntry, now time.Time) bool {
+	if c.label != "" {
+		if ok, _ := path.Match(c.label, e.Label); !ok {
+			return false
+		}
+	}
+	if c.since > 0 && e.Created.Before(now.Add(-time.Duration(c.since))) {
+		return false
+	}
+	if c.expired && (e.MetadataExpires.IsZero() || now.Before(e.MetadataExpires)) {
+		return false
+	}
+	return true
+}
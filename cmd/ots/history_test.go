@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	ots "github.com/corbaltcode/go-onetimesecret"
+)
+
+func TestHistoryInContext(t *testing.T) {
+	ctx, _ := newTestContext(t)
+	server := historyServer(ctx.Client)
+	work := ctx
+	work.Profile = "work"
+	defaultServer := ctx
+	defaultServer.Client = ots.NewAnonymousClient()
+
+	tests := []struct {
+		entry historyEntry
+		ctx   cmdContext
+		want  bool
+	}{
+		{historyEntry{Profile: defaultProfile, Server: server}, ctx, true},
+		{historyEntry{Server: server}, ctx, true},
+		{historyEntry{Profile: "work", Server: server}, ctx, false},
+		{historyEntry{Profile: "work", Server: server}, work, true},
+		{historyEntry{Profile: defaultProfile}, ctx, false},
+		{historyEntry{}, defaultServer, true},
+		{historyEntry{Profile: defaultProfile, Server: server}, defaultServer, false},
+	}
+	for _, tt := range tests {
+		if got := tt.entry.inContext(tt.ctx); got != tt.want {
+			t.Errorf("entry with profile %q and server %q in profile %q and server %q: got %v (want %v)", tt.entry.Profile, tt.entry.Server, tt.ctx.Profile, historyServer(tt.ctx.Client), got, tt.want)
+		}
+	}
+}
+
+func TestHistoryPruneOtherProfiles(t *testing.T) {
+	ctx, _ := newTestContext(t)
+	server := historyServer(ctx.Client)
+	expired := time.Now().Add(-time.Hour)
+	err := appendHistory([]historyEntry{
+		{MetadataKey: "a", MetadataExpires: expired, Profile: defaultProfile, Server: server},
+		{MetadataKey: "b", MetadataExpires: expired, Profile: "work", Server: server},
+		{MetadataKey: "c", MetadataExpires: expired},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &historyCmd{expired: true, prune: true}
+	if err := cmd.Run(ctx, nil); err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+
+	entries, err := loadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.MetadataKey)
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %q (want %q)", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -10,13 +11,21 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"net/mail"
+	"net/url"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	ots "github.com/corbaltcode/go-onetimesecret"
 	"golang.org/x/term"
 )
@@ -29,9 +38,12 @@ func (e usageErr) Error() string {
 	return string(e)
 }
 
-type config struct {
-	Username string
-	Key      string
+// exitStatus is returned by a command to exit with a status other than 0
+// without printing an error.
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
 }
 
 type cmd interface {
@@ -40,78 +52,165 @@ type cmd interface {
 }
 
 type cmdContext struct {
-	JSON   bool
-	Client *ots.Client
+	JSON    bool
+	Client  *ots.Client
+	Context context.Context
+
+	// Profile is the name of the selected config profile.
+	Profile string
+
+	// RequirePassphrase is set by the profile's passphrase policy.
+	RequirePassphrase bool
 }
 
 type cmdType struct {
-	Name    string
-	Params  string
-	Summary string
-	Help    string
-	NewCmd  func() cmd
+	Name         string
+	Params       string
+	Summary      string
+	Help         string
+	RequiresAuth bool
+
+	// ManagesConfig is set for commands that manage the config file. They run
+	// even if the selected profile is missing or incomplete, with a client
+	// configured only by options and the environment.
+	ManagesConfig bool
+
+	NewCmd func() cmd
 }
 
 func (c *cmdType) Usage() string {
 	return usage(c.Name, c.Params)
 }
 
-var relativeConfigPath = filepath.Join("ots", "config.toml")
-
 var cmdTypes = []cmdType{
 	{
-		Name:    "burn",
-		Params:  "[-passphrase <string>] metadata-key",
-		Summary: "Destroys a secret",
-		Help:    "Destroys a secret. Prints the destroyed secret's metadata key. If passphrase is \"-\", reads a line from stdin.",
+		Name:         "burn",
+		Params:       "[-passphrase <string>] [-all-recent] [-from-file <path>] [-label <pattern>] [-concurrency <int>] [metadata-key | metadata-url]...",
+		Summary:      "Destroys secrets",
+		Help:         "Destroys a secret, including every chunk of a secret too large to store in one piece. Prints the destroyed secret's metadata key. If passphrase is \"-\", reads a line from stdin.\n\nTo destroy many secrets at once, such as when a laptop is lost, select them with any of: several metadata keys or URLs; -all-recent, which selects recently created secrets that have not been retrieved or burned; -from-file, which reads a metadata key or URL from each line of a file (\"-\" for stdin), skipping blank lines and lines beginning with \"#\"; and -label, which selects secrets in the history (see \"ots help history\") whose label matches a pattern. The secrets are burned concurrently, up to concurrency (default 4) at a time, with the passphrase, if any. Prints each metadata key with its result: burned, gone (already retrieved, burned, or expired, or the passphrase is incorrect), or failed, with the error. Then prints a summary to stderr and exits with status 1 if any failed.",
+		RequiresAuth: true,
 		NewCmd: func() cmd {
 			return &burnCmd{}
 		},
 	},
+	{
+		Name:          "config",
+		Params:        "list | show [<profile>] | set <profile> <field> <value> | use <profile>",
+		Summary:       "Manages config profiles",
+		Help:          "Manages the profiles in the config file, each holding the settings for one account or server. The settings at the top level of the config file form the \"default\" profile; others are in [profiles.<name>] sections. Commands use the profile given by -profile or the environment variable OTS_PROFILE, or else the one chosen with \"ots config use\", or else the default profile. The -username, -key, and -url options and the OTS_USERNAME, OTS_KEY, and OTS_URL environment variables override the profile's settings.\n\n\"list\" prints each profile's name, whether it is selected, its username, and its URL. \"show\" prints a profile's settings, masking the key; it shows the selected profile if none is given. \"set\" sets a field of a profile, creating the profile if needed; the fields are username, key, key_file (a file holding the key), key_command (a shell command that prints the key, such as \"pass show ots\"), url, ttl (the default TTL of stored and generated secrets, such as \"7d\"), and passphrase (the passphrase policy: \"optional\", or \"required\" to refuse to store secrets without a passphrase). An empty value clears the field. If the field is key and the value is \"-\", reads a line from stdin. \"use\" chooses the profile to use by default.\n\n\"set\" and \"use\" rewrite the config file, dropping any comments.",
+		ManagesConfig: true,
+		NewCmd: func() cmd {
+			return &configCmd{}
+		},
+	},
 	{
 		Name:    "gen",
-		Params:  "[-passphrase <string>] [-ttl <seconds>]",
+		Params:  "[-passphrase <string>] [-ttl <duration>] [-recipient <email>]... [-url-only] [-label <string>]",
 		Summary: "Generates a secret",
-		Help:    "Generates a secret. Prints the secret, secret key, and metadata key. If passphrase is \"-\", reads a line from stdin.",
+		Help:    "Generates a secret. Prints the secret, secret key, metadata key, expiry time, secret URL, and metadata URL, or with -url-only, just the secret URL. If passphrase is \"-\", reads a line from stdin. If -recipient is specified, the server emails each recipient a link to their own generated secret, and the obfuscated recipient is printed at the end of each secret's line. Records the secret, with the label given by -label, in the history printed by \"ots history\".",
 		NewCmd: func() cmd {
 			return &generateCmd{}
 		},
 	},
 	{
 		Name:    "get",
-		Params:  "[-passphrase <string>] secret-key",
+		Params:  "[-passphrase <string>] [-max-ratio <int>] secret-key | secret-url",
 		Summary: "Retrieves a secret",
-		Help:    "Retrieves, prints, and destroys a secret. If passphrase is \"-\", reads a line from stdin.",
+		Help:    "Retrieves, prints, and destroys a secret. Compressed secrets are decompressed, unless they would expand to more than max-ratio times their stored size (default 100). To retrieve a secret stored with \"ots put -e2e\", provide its secret URL, which holds the decryption key. If passphrase is \"-\", reads a line from stdin.",
 		NewCmd: func() cmd {
 			return &getCmd{}
 		},
 	},
+	{
+		Name:    "get-file",
+		Params:  "[-passphrase <string>] [-max-ratio <int>] [-o <path>] [-force] secret-key | secret-url",
+		Summary: "Retrieves a file",
+		Help:    "Retrieves and destroys a file stored with \"ots put-file\" and writes it to path with its original permissions. If path is omitted, writes to the file's original name in the current directory; if path is \"-\", writes to stdout. Refuses to overwrite an existing file unless -force is specified; if path is omitted and the original name is taken, writes to name-1, name-2, and so on instead. Refuses to write a file whose checksum does not match. To retrieve a file stored with \"ots put-file -e2e\", provide its secret URL. See \"ots help get\" for -max-ratio. If passphrase is \"-\", reads a line from stdin.",
+		NewCmd: func() cmd {
+			return &getFileCmd{}
+		},
+	},
+	{
+		Name:    "history",
+		Params:  "[-label <pattern>] [-since <duration>] [-expired] [-prune] [-all-profiles]",
+		Summary: "Prints secrets created with ots",
+		Help:    "Prints the history of secrets created with \"ots put\", \"ots put-file\", and \"ots gen\": when each was created, its label, metadata key, metadata URL, secret URL, TTL, the times the secret and metadata expire, its obfuscated recipient, and the profile and server (empty for onetimesecret.com) it was created with. The history is kept in the file history.jsonl next to the config file, readable only by you; it holds secret URLs, which allow retrieving secrets, but not the decryption keys of secrets stored with -e2e.\n\nPrints only secrets created with the selected profile and server, as do \"ots burn -label\" and \"ots notify\"; -all-profiles prints secrets from every profile and server. -label prints only secrets whose label matches a pattern such as \"deploy-*\", -since only secrets created within a duration, and -expired only secrets whose metadata has expired. With -prune, removes the matching secrets from the history and prints them; -prune requires at least one of -label, -since, and -expired.",
+		NewCmd: func() cmd {
+			return &historyCmd{}
+		},
+	},
+	{
+		Name:          "login",
+		Summary:       "Saves credentials to the config file",
+		Help:          "Prompts for a username and API key, unless given with -username and -key, verifies them with the server, and saves them to the selected profile in the config file (see \"ots help config\"), replacing any key_file or key_command. The config file is readable only by you. If -url or OTS_URL is given, saves the URL too; otherwise verifies with the profile's URL. When stdin is not a terminal, reads the username and key from its first two lines.",
+		ManagesConfig: true,
+		NewCmd: func() cmd {
+			return &loginCmd{}
+		},
+	},
 	{
 		Name:    "meta",
-		Params:  "metadata-key",
+		Params:  "metadata-key | metadata-url",
 		Summary: "Prints a secret's metadata",
-		Help:    "Prints a secret's metadata.",
+		Help:    "Prints a secret's metadata. Given the metadata key of a secret that was split into chunks, prints the metadata of the manifest followed by that of each chunk.",
 		NewCmd: func() cmd {
 			return &metadataCmd{}
 		},
 	},
+	{
+		Name:    "notify",
+		Params:  "[-interval <duration>] [-expiry-warning <duration>] [-exec <command>] [-webhook <url>] [-desktop] [-label <pattern>] [-all-recent] [metadata-key | metadata-url]...",
+		Summary: "Notifies when secrets change state",
+		Help:    "Polls the metadata of secrets every interval (default 1m) until interrupted, and prints a line for each secret that is received, burned, or expired, or that will expire unread within expiry-warning (default 1h; 0 disables the warning). Changes made before the first poll are not reported.\n\nWatches the given secrets or, if none are given, the unexpired secrets in the history (see \"ots help history\") when notify starts; -label watches the secrets in the history whose label matches a pattern. These are polled one by one, which works without a username and key but marks new secrets viewed, so views are not reported. -all-recent instead watches recently created secrets, including those created while notify runs, and also reports views; it requires a username and key.\n\nFor each event, -exec runs a shell command with the event in the environment variables OTS_EVENT, OTS_METADATA_KEY, OTS_STATE, and OTS_SECRET_EXPIRES and as JSON on stdin; -webhook posts the event as JSON to a URL; and -desktop shows a desktop notification.",
+		NewCmd: func() cmd {
+			return &notifyCmd{}
+		},
+	},
 	{
 		Name:    "put",
 		Summary: "Stores a secret",
-		Help:    "Stores a secret. Prints the secret key and metadata key. If passphrase is \"-\", reads a line from stdin. If secret is \"-\", reads a line from stdin or, if stdin is not a terminal, reads until EOF.",
-		Params:  "[-passphrase <string>] [-ttl <int>] secret",
+		Help:    "Stores a secret. Prints the secret key, metadata key, expiry time, secret URL, and metadata URL, or with -url-only, just the secret URL. If passphrase is \"-\", reads a line from stdin. If secret is \"-\", reads a line from stdin or, if stdin is not a terminal, reads until EOF. A secret too large to store in one piece is split into chunks, which \"ots get\" reassembles; the printed metadata key then identifies every chunk, no metadata URL is printed, and the secret URL can only be used with \"ots get\". If -compress is specified, compresses the secret if that makes it smaller. If -e2e is specified, encrypts the secret locally so the server never sees it, and prints the secret URL, which holds the decryption key, instead of the secret key. If -recipient is specified, stores a copy of the secret for each recipient, whom the server emails a link to it, and prints the obfuscated recipient at the end of each copy's line; -recipient cannot be combined with -compress or -e2e. Records the secret, with the label given by -label, in the history printed by \"ots history\".",
+		Params:  "[-passphrase <string>] [-ttl <duration>] [-recipient <email>]... [-compress] [-e2e] [-url-only] [-label <string>] secret",
 		NewCmd: func() cmd {
 			return &putCmd{}
 		},
 	},
 	{
-		Name:    "recent",
-		Summary: "Prints metadata of recently created secrets",
-		Help:    "Prints metadata of recently created secrets.",
+		Name:    "put-batch",
+		Params:  "[-o <path>] [-concurrency <int>] [-rate <float>] manifest",
+		Summary: "Stores many secrets from a manifest",
+		Help:    "Stores or generates a secret for each row of a manifest: a CSV file with a header row naming any of the columns secret, recipient, passphrase, ttl, and label or, if the path ends in \".json\", a JSON array of objects with those keys. A secret of \"gen\" generates a secret. Every row is checked before any secret is stored. Stores up to concurrency (default 4) secrets at a time and at most rate (default 2) per second; a rate of 0 is unlimited. Writes an output manifest to path (default: the manifest's name with \".out\" before its extension), in JSON if path ends in \".json\" and CSV otherwise, giving each row's label, recipient, generated secret (for rows of \"gen\"), secret URL, metadata key, metadata URL, expiry time, and status (ok or failed) with any error, and prints the same. Generated secrets appear nowhere else, so keep the output manifest until they have been used; it is readable only by you. If the output manifest exists, rows it lists as ok are skipped, so a failed or interrupted run can be resumed by running the same command again. Exits with status 1 if any row failed.",
+		NewCmd: func() cmd {
+			return &putBatchCmd{}
+		},
+	},
+	{
+		Name:    "put-file",
+		Summary: "Stores a file",
+		Help:    "Stores a file, including binary files, along with its name, permissions, and checksum. Prints and records the same as \"ots put\". If passphrase is \"-\", reads a line from stdin. If -compress is specified, compresses the file if that makes it smaller. If -e2e is specified, encrypts the file locally so the server never sees it, and prints the secret URL, which holds the decryption key, instead of the secret key.",
+		Params:  "[-passphrase <string>] [-ttl <duration>] [-compress] [-e2e] [-url-only] [-label <string>] path",
+		NewCmd: func() cmd {
+			return &putFileCmd{}
+		},
+	},
+	{
+		Name:         "recent",
+		Summary:      "Prints metadata of recently created secrets",
+		Help:         "Prints metadata of recently created secrets.",
+		RequiresAuth: true,
 		NewCmd: func() cmd {
 			return &recentCmd{}
 		},
 	},
+	{
+		Name:    "watch",
+		Params:  "metadata-key | metadata-url",
+		Summary: "Waits until a secret is retrieved, burned, or expired",
+		Help:    "Waits until a secret is received, burned, or expired, polling its metadata with increasing delays up to a minute. Prints the secret's metadata key, its final state (received, burned, or expired), and the time of its last change. Exits with status 0 if the secret was received, 2 if it was burned, and 3 if it expired; otherwise, such as after -timeout elapses, exits with status 1.",
+		NewCmd: func() cmd {
+			return &watchCmd{}
+		},
+	},
 	{
 		Name:    "status",
 		Summary: "Prints system status",
@@ -163,11 +262,19 @@ func main() {
 	var ctx cmdContext
 	ctx.Client = &client
 
+	var baseURL string
+	var profileName string
+	var timeout time.Duration
+
 	flags := flag.NewFlagSet("", flag.ContinueOnError)
 	flags.SetOutput(&bytes.Buffer{}) // tell flags not to print errors; we'll do that
 	flags.StringVar(&client.Username, "username", "", "")
 	flags.StringVar(&client.Key, "key", "", "")
+	flags.StringVar(&baseURL, "url", "", "")
+	flags.StringVar(&profileName, "profile", "", "")
+	flags.BoolVar(&client.Anonymous, "anonymous", false, "")
 	flags.BoolVar(&ctx.JSON, "json", false, "")
+	flags.DurationVar(&timeout, "timeout", 0, "")
 	cmd.AddFlags(flags)
 
 	err = flags.Parse(os.Args[2:])
@@ -181,29 +288,54 @@ func main() {
 	if err != nil {
 		log.Fatalf("error reading config: %v\n", err)
 	}
+	warnIfConfigReadable()
 
-	if client.Username == "" {
-		client.Username = os.Getenv("OTS_USERNAME")
-	}
-	if client.Username == "" {
-		client.Username = cfg.Username
+	if profileName == "" {
+		profileName = os.Getenv("OTS_PROFILE")
 	}
-	if client.Username == "" {
-		log.Fatalln("missing username; run 'ots help'")
+	var prof profile
+	ctx.Profile, prof, err = cfg.selectProfile(profileName)
+
+	if baseURL == "" {
+		baseURL = os.Getenv("OTS_URL")
 	}
 
-	if client.Key == "" {
-		client.Key = os.Getenv("OTS_KEY")
+	// commands that manage the config run even if the selected profile is
+	// missing or incomplete so that it can be fixed
+	if !cmdType.ManagesConfig {
+		if err != nil {
+			log.Fatalln(err)
+		}
+		configureClient(&ctx, cmdType, prof)
+		if baseURL == "" {
+			baseURL = prof.URL
+		}
 	}
-	if client.Key == "" {
-		client.Key = cfg.Key
+
+	if baseURL != "" {
+		client.BaseURL, err = parseBaseURL(baseURL)
+		if err != nil {
+			log.Fatalf("invalid url: %v\n", err)
+		}
 	}
-	if client.Key == "" {
-		log.Fatalln("missing key; run 'ots help'")
+
+	var stop, cancel context.CancelFunc
+	ctx.Context, stop = signal.NotifyContext(context.Background(), os.Interrupt)
+	// the timeout limits the whole command, prompts included, so that it
+	// also bounds commands such as watch that wait rather than make requests
+	if timeout > 0 {
+		ctx.Context, cancel = context.WithTimeout(ctx.Context, timeout)
+	} else {
+		ctx.Context, cancel = context.WithCancel(ctx.Context)
 	}
 
 	err = cmd.Run(ctx, flags.Args())
+	cancel()
+	stop()
 
+	if status, ok := err.(exitStatus); ok {
+		os.Exit(int(status))
+	}
 	if err != nil {
 		log.Println(err)
 		_, ok := err.(usageErr)
@@ -214,19 +346,88 @@ func main() {
 	}
 }
 
+// configureClient applies the selected profile and the credentials given in
+// the environment or the profile to ctx and its client.
+func configureClient(ctx *cmdContext, cmdType cmdType, prof profile) {
+	client := ctx.Client
+	var err error
+	if prof.TTL != "" {
+		client.DefaultTTL, err = parseTTL(prof.TTL)
+		if err != nil {
+			log.Fatalf("invalid ttl in profile %v: %v\n", ctx.Profile, err)
+		}
+	}
+	switch prof.Passphrase {
+	case "", passphraseOptional:
+	case passphraseRequired:
+		ctx.RequirePassphrase = true
+	default:
+		log.Fatalf("invalid passphrase policy in profile %v: %q\n", ctx.Profile, prof.Passphrase)
+	}
+
+	if client.Anonymous && cmdType.RequiresAuth {
+		log.Fatalf("'ots %v' requires a username and key; remove -anonymous\n", cmdType.Name)
+	}
+
+	if !client.Anonymous {
+		if client.Username == "" {
+			client.Username = os.Getenv("OTS_USERNAME")
+		}
+		if client.Username == "" {
+			client.Username = prof.Username
+		}
+
+		if client.Key == "" {
+			client.Key = os.Getenv("OTS_KEY")
+		}
+		if client.Key == "" {
+			client.Key, err = prof.getKey()
+			if err != nil {
+				log.Fatalf("error reading key: %v\n", err)
+			}
+		}
+
+		if client.Username == "" && client.Key == "" && !cmdType.RequiresAuth {
+			client.Anonymous = true
+		} else if client.Username == "" {
+			log.Fatalln("missing username; run 'ots help'")
+		} else if client.Key == "" {
+			log.Fatalln("missing key; run 'ots help'")
+		}
+	}
+}
+
 type burnCmd struct {
-	passphrase string
+	passphrase  string
+	allRecent   bool
+	fromFile    string
+	label       string
+	concurrency int
 }
 
 func (c *burnCmd) AddFlags(flags *flag.FlagSet) {
 	flags.StringVar(&c.passphrase, "passphrase", "", "")
+	flags.BoolVar(&c.allRecent, "all-recent", false, "")
+	flags.StringVar(&c.fromFile, "from-file", "", "")
+	flags.StringVar(&c.label, "label", "", "")
+	flags.IntVar(&c.concurrency, "concurrency", 4, "")
 }
 
 func (c *burnCmd) Run(ctx cmdContext, args []string) error {
-	if len(args) < 1 {
-		return usageErr("missing arg: metadata-key")
-	} else if len(args) > 1 {
-		return usageErr("too many args")
+	bulk := len(args) > 1 || c.allRecent || c.fromFile != "" || c.label != ""
+	if len(args) < 1 && !bulk {
+		return usageErr("missing arg: metadata-key or metadata-url")
+	}
+	if c.concurrency < 1 {
+		return usageErr("-concurrency must be at least 1")
+	}
+	if c.label != "" {
+		if _, err := path.Match(c.label, ""); err != nil {
+			return usageErr(fmt.Sprintf("invalid label pattern: %v", c.label))
+		}
+	}
+	if c.passphrase == stdinArg && c.fromFile == stdinArg {
+		return usageErr("-passphrase and -from-file cannot both read stdin")
 	}
 
 	if c.passphrase == stdinArg {
@@ -235,28 +436,198 @@ func (c *burnCmd) Run(ctx cmdContext, args []string) error {
 		}
 	}
 
-	metadataKey := args[0]
-	meta, err := ctx.Client.Burn(metadataKey, c.passphrase)
+	if !bulk {
+		metadataKey, err := ots.ParseMetadataURL(args[0])
+		if err != nil {
+			return usageErr(err.Error())
+		}
+
+		if err := burn(ctx, metadataKey, c.passphrase); err != nil {
+			return err
+		}
+
+		result := struct {
+			MetadataKey string
+		}{metadataKey}
+
+		printResult(result, ctx.JSON)
+		return nil
+	}
+
+	metadataKeys, err := c.selectKeys(ctx, args)
 	if err != nil {
 		return err
 	}
 
-	result := struct {
-		MetadataKey string
-	}{meta.MetadataKey}
+	// burning many secrets may exceed the server's rate limit
+	if ctx.Client.Retry == nil {
+		ctx.Client.Retry = &ots.RetryPolicy{MaxAttempts: 5}
+	}
+	results := burnAll(ctx, metadataKeys, c.passphrase, c.concurrency)
+
+	var burned, gone, failed int
+	for _, r := range results {
+		switch r.Result {
+		case "burned":
+			burned++
+		case "gone":
+			gone++
+		default:
+			failed++
+		}
+	}
+	printResult(results, ctx.JSON)
+	log.Printf("burned %v, already gone %v, failed %v\n", burned, gone, failed)
 
-	printResult(result, ctx.JSON)
+	if failed > 0 {
+		return exitStatus(1)
+	}
 	return nil
 }
 
+// selectKeys returns the metadata keys of the secrets selected by args and
+// flags, without duplicates.
+func (c *burnCmd) selectKeys(ctx cmdContext, args []string) ([]string, error) {
+	var keys []string
+	seen := map[string]bool{}
+	add := func(s string) error {
+		metadataKey, err := ots.ParseMetadataURL(s)
+		if err != nil {
+			return err
+		}
+		if !seen[metadataKey] {
+			seen[metadataKey] = true
+			keys = append(keys, metadataKey)
+		}
+		return nil
+	}
+
+	for _, arg := range args {
+		if err := add(arg); err != nil {
+			return nil, usageErr(err.Error())
+		}
+	}
+
+	if c.fromFile != "" {
+		var r io.Reader = os.Stdin
+		if c.fromFile != stdinArg {
+			f, err := os.Open(c.fromFile)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+		scanner := bufio.NewScanner(r)
+		for line := 1; scanner.Scan(); line++ {
+			s := strings.TrimSpace(scanner.Text())
+			if s == "" || strings.HasPrefix(s, "#") {
+				continue
+			}
+			if err := add(s); err != nil {
+				return nil, fmt.Errorf("%v, line %v: %w", c.fromFile, line, err)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.label != "" {
+		entries, err := loadHistory()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.inContext(ctx) {
+				continue
+			}
+			if ok, _ := path.Match(c.label, e.Label); ok {
+				if err := add(e.MetadataKey); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if c.allRecent {
+		metas, err := ctx.Client.GetRecentMetadataContext(ctx.Context)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range metas {
+			if m.State == ots.SecretStateNew || m.State == ots.SecretStateViewed {
+				if err := add(m.MetadataKey); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// burn destroys a secret, including every chunk of a chunked secret.
+func burn(ctx cmdContext, metadataKey string, passphrase string) error {
+	var err error
+	if ots.IsChunkedMetadataKey(metadataKey) {
+		_, err = ctx.Client.BurnChunkedContext(ctx.Context, metadataKey, passphrase)
+	} else {
+		_, err = ctx.Client.BurnContext(ctx.Context, metadataKey, passphrase)
+	}
+	return err
+}
+
+type burnResult struct {
+	MetadataKey string
+	Result      string
+	Error       string
+}
+
+// burnAll burns secrets using a pool of concurrent workers and returns the
+// outcome for each, in order.
+func burnAll(ctx cmdContext, metadataKeys []string, passphrase string, workers int) []burnResult {
+	results := make([]burnResult, len(metadataKeys))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = burnResult{MetadataKey: metadataKeys[i], Result: "burned"}
+				err := burn(ctx, metadataKeys[i], passphrase)
+				if errors.Is(err, ots.ErrNotFound) {
+					results[i].Result = "gone"
+				} else if err != nil {
+					results[i].Result = "failed"
+					results[i].Error = err.Error()
+				}
+			}
+		}()
+	}
+	for i := range metadataKeys {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
 type generateCmd struct {
 	passphrase string
-	secretTTL  int
+	secretTTL  ttlValue
+	recipients recipientsValue
+	urlOnly    bool
+	label      string
 }
 
 func (c *generateCmd) AddFlags(flags *flag.FlagSet) {
 	flags.StringVar(&c.passphrase, "passphrase", "", "")
-	flags.IntVar(&c.secretTTL, "ttl", 0, "")
+	flags.Var(&c.secretTTL, "ttl", "")
+	flags.Var(&c.recipients, "recipient", "")
+	flags.BoolVar(&c.urlOnly, "url-only", false, "")
+	flags.StringVar(&c.label, "label", "", "")
 }
 
 func (c *generateCmd) Run(ctx cmdContext, args []string) error {
@@ -269,17 +640,73 @@ func (c *generateCmd) Run(ctx cmdContext, args []string) error {
 			return err
 		}
 	}
+	if err := checkPassphrase(ctx, c.passphrase); err != nil {
+		return err
+	}
 
-	secret, meta, err := ctx.Client.Generate(c.passphrase, c.secretTTL, "")
+	opts := ots.GenerateOptions{Passphrase: c.passphrase, TTL: time.Duration(c.secretTTL)}
+
+	if len(c.recipients) > 0 {
+		type recipientResult struct {
+			Secret        string
+			SecretKey     string
+			MetadataKey   string
+			SecretExpires time.Time
+			SecretURL     string
+			MetadataURL   string
+			Recipient     string
+		}
+		results := []recipientResult{}
+		var urls []string
+		print := func() {
+			if c.urlOnly {
+				printURLs(urls, ctx.JSON)
+			} else {
+				printResult(results, ctx.JSON)
+			}
+		}
+		for _, recipient := range c.recipients {
+			opts.Recipient = recipient
+			b, meta, err := ctx.Client.GenerateWithOptions(ctx.Context, opts)
+			if err != nil {
+				// print the secrets already generated, which would otherwise
+				// be lost
+				print()
+				return err
+			}
+			secret := string(b)
+			ots.Wipe(b)
+			secretURL, metadataURL := shareURLs(meta)
+			recordHistory(newHistoryEntry(ctx, meta, meta.MetadataKey, secretURL, metadataURL, c.label))
+			results = append(results, recipientResult{secret, meta.SecretKey, meta.MetadataKey, meta.SecretExpiresAt(), secretURL, metadataURL, meta.ObfuscatedRecipient})
+			urls = append(urls, secretURL)
+		}
+		print()
+		return nil
+	}
+
+	b, meta, err := ctx.Client.GenerateWithOptions(ctx.Context, opts)
 	if err != nil {
 		return err
 	}
+	secret := string(b)
+	ots.Wipe(b)
+	secretURL, metadataURL := shareURLs(meta)
+	recordHistory(newHistoryEntry(ctx, meta, meta.MetadataKey, secretURL, metadataURL, c.label))
+
+	if c.urlOnly {
+		printURLs([]string{secretURL}, ctx.JSON)
+		return nil
+	}
 
 	result := struct {
-		Secret      string
-		SecretKey   string
-		MetadataKey string
-	}{secret, meta.SecretKey, meta.MetadataKey}
+		Secret        string
+		SecretKey     string
+		MetadataKey   string
+		SecretExpires time.Time
+		SecretURL     string
+		MetadataURL   string
+	}{secret, meta.SecretKey, meta.MetadataKey, meta.SecretExpiresAt(), secretURL, metadataURL}
 
 	printResult(result, ctx.JSON)
 	return nil
@@ -287,15 +714,17 @@ func (c *generateCmd) Run(ctx cmdContext, args []string) error {
 
 type getCmd struct {
 	passphrase string
+	maxRatio   int
 }
 
 func (c *getCmd) AddFlags(flags *flag.FlagSet) {
 	flags.StringVar(&c.passphrase, "passphrase", "", "")
+	flags.IntVar(&c.maxRatio, "max-ratio", 0, "")
 }
 
 func (c *getCmd) Run(ctx cmdContext, args []string) error {
 	if len(args) < 1 {
-		return usageErr("missing arg: secret-key")
+		return usageErr("missing arg: secret-key or secret-url")
 	} else if len(args) > 1 {
 		return usageErr("too many args")
 	}
@@ -306,15 +735,126 @@ func (c *getCmd) Run(ctx cmdContext, args []string) error {
 		}
 	}
 
-	secretKey := args[0]
-	secret, err := ctx.Client.Get(secretKey, c.passphrase)
+	secretKey, err := ots.ParseSecretURL(args[0])
+	if err != nil {
+		return usageErr(err.Error())
+	}
+
+	ctx.Client.MaxCompressionRatio = c.maxRatio
+
+	var secret []byte
+	if isEncryptedURL(args[0]) {
+		secret, err = ctx.Client.EncryptedGetBytesContext(ctx.Context, args[0], c.passphrase)
+	} else {
+		secret, err = ctx.Client.GetChunkedContext(ctx.Context, secretKey, c.passphrase)
+		if err == nil && ots.IsEncryptedBytes(secret) {
+			ots.Wipe(secret)
+			err = errors.New("secret is end-to-end encrypted and has been destroyed; retrieve encrypted secrets with their secret URL")
+		}
+	}
 	if err != nil {
 		return err
 	}
+	defer ots.Wipe(secret)
+
+	if ctx.JSON {
+		result := struct {
+			Secret ots.SecretBytes
+		}{secret}
+		printResult(result, true)
+	} else {
+		os.Stdout.Write(secret)
+		fmt.Println("")
+	}
+	return nil
+}
+
+type getFileCmd struct {
+	passphrase string
+	maxRatio   int
+	output     string
+	force      bool
+}
+
+func (c *getFileCmd) AddFlags(flags *flag.FlagSet) {
+	flags.StringVar(&c.passphrase, "passphrase", "", "")
+	flags.IntVar(&c.maxRatio, "max-ratio", 0, "")
+	flags.StringVar(&c.output, "o", "", "")
+	flags.BoolVar(&c.force, "force", false, "")
+}
+
+func (c *getFileCmd) Run(ctx cmdContext, args []string) error {
+	if len(args) < 1 {
+		return usageErr("missing arg: secret-key or secret-url")
+	} else if len(args) > 1 {
+		return usageErr("too many args")
+	}
+
+	if c.passphrase == stdinArg {
+		if err := readSecretShort(&c.passphrase, "passphrase"); err != nil {
+			return err
+		}
+	}
+
+	secretKey, err := ots.ParseSecretURL(args[0])
+	if err != nil {
+		return usageErr(err.Error())
+	}
+
+	// check the output path before retrieving the file, which destroys it
+	if c.output != "" && c.output != stdinArg && !c.force {
+		if _, err := os.Lstat(c.output); err == nil {
+			return fmt.Errorf("%v already exists; specify -force to overwrite it", c.output)
+		}
+	}
+
+	ctx.Client.MaxCompressionRatio = c.maxRatio
+
+	var secret []byte
+	if isEncryptedURL(args[0]) {
+		secret, err = ctx.Client.EncryptedGetBytesContext(ctx.Context, args[0], c.passphrase)
+	} else {
+		secret, err = ctx.Client.GetChunkedContext(ctx.Context, secretKey, c.passphrase)
+	}
+	if err != nil {
+		return err
+	}
+	defer ots.Wipe(secret)
+
+	file, err := ots.DecodeFile(secret)
+	if err != nil {
+		return err
+	}
+	defer ots.Wipe(file.Data)
+
+	path := c.output
+	if path == stdinArg {
+		_, err := os.Stdout.Write(file.Data)
+		return err
+	}
+	if path == "" && !c.force {
+		// the secret is already gone, so rather than fail, write the file
+		// under a name that isn't taken
+		if path, err = writeNewFile(file.Name, file.Data, file.Mode); err != nil {
+			return err
+		}
+		if path != file.Name {
+			log.Printf("%v already exists; wrote %v\n", file.Name, path)
+		}
+	} else {
+		if path == "" {
+			path = file.Name
+		}
+		if err := writeFile(path, file.Data, file.Mode, c.force); err != nil {
+			return err
+		}
+	}
 
 	result := struct {
-		Secret string
-	}{secret}
+		Path string
+		Size int
+		Mode string
+	}{path, len(file.Data), file.Mode.String()}
 
 	printResult(result, ctx.JSON)
 	return nil
@@ -328,65 +868,467 @@ func (c *metadataCmd) AddFlags(flags *flag.FlagSet) {
 
 func (c *metadataCmd) Run(ctx cmdContext, args []string) error {
 	if len(args) < 1 {
-		return usageErr("missing arg: metadata-key")
+		return usageErr("missing arg: metadata-key or metadata-url")
 	} else if len(args) > 1 {
 		return usageErr("too many args")
 	}
 
-	metadataKey := args[0]
-	meta, err := ctx.Client.GetMetadata(metadataKey)
+	keys, err := ots.ParseChunkedMetadataKey(args[0])
+	if err != nil {
+		return usageErr(err.Error())
+	}
+
+	var results []metadataResult
+	for _, key := range keys {
+		meta, err := ctx.Client.GetMetadataContext(ctx.Context, key)
+		if err != nil {
+			return err
+		}
+		results = append(results, metadataResult{meta, meta.SecretExpiresAt(), meta.MetadataExpiresAt()})
+	}
+
+	if len(results) == 1 {
+		printResult(results[0], ctx.JSON)
+	} else {
+		printResult(results, ctx.JSON)
+	}
+	return nil
+}
+
+type metadataResult struct {
+	ots.Metadata
+	SecretExpires   time.Time
+	MetadataExpires time.Time
+}
+
+type notifyCmd struct {
+	interval      time.Duration
+	expiryWarning time.Duration
+	command       string
+	webhook       string
+	desktop       bool
+	label         string
+	allRecent     bool
+}
+
+func (c *notifyCmd) AddFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&c.interval, "interval", time.Minute, "")
+	flags.DurationVar(&c.expiryWarning, "expiry-warning", time.Hour, "")
+	flags.StringVar(&c.command, "exec", "", "")
+	flags.StringVar(&c.webhook, "webhook", "", "")
+	flags.BoolVar(&c.desktop, "desktop", false, "")
+	flags.StringVar(&c.label, "label", "", "")
+	flags.BoolVar(&c.allRecent, "all-recent", false, "")
+}
+
+func (c *notifyCmd) Run(ctx cmdContext, args []string) error {
+	if c.interval <= 0 {
+		return usageErr("-interval must be positive")
+	}
+	if c.desktop && !desktopNotificationsSupported() {
+		return usageErr(fmt.Sprintf("-desktop is not supported on %v", runtime.GOOS))
+	}
+	if c.webhook != "" {
+		u, err := url.Parse(c.webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return usageErr(fmt.Sprintf("invalid webhook url: %v", c.webhook))
+		}
+	}
+
+	if c.label != "" {
+		if _, err := path.Match(c.label, ""); err != nil {
+			return usageErr(fmt.Sprintf("invalid label pattern: %v", c.label))
+		}
+	}
+	if c.allRecent && (len(args) > 0 || c.label != "") {
+		return usageErr("-all-recent cannot be combined with metadata keys or -label")
+	}
+	if c.allRecent && ctx.Client.Anonymous {
+		return errors.New("-all-recent requires a username and key; run 'ots help'")
+	}
+
+	var metadataKeys []string
+	if !c.allRecent {
+		var err error
+		metadataKeys, err = c.selectKeys(ctx, args)
+		if err != nil {
+			return err
+		}
+		if len(metadataKeys) == 0 {
+			return errors.New("no unexpired secrets in the history to watch")
+		}
+	}
+
+	notifiers := []ots.Notifier{ots.NotifierFunc(func(_ context.Context, e ots.Event) error {
+		printEvent(e, ctx.JSON)
+		return nil
+	})}
+	if c.command != "" {
+		notifiers = append(notifiers, commandNotifier{c.command})
+	}
+	if c.webhook != "" {
+		notifiers = append(notifiers, &ots.WebhookNotifier{URL: c.webhook, HTTPClient: ctx.Client.HTTPClient})
+	}
+	if c.desktop {
+		notifiers = append(notifiers, desktopNotifier{})
+	}
+
+	w := ots.Watcher{
+		Client:        ctx.Client,
+		Notifier:      ots.MultiNotifier(notifiers...),
+		MetadataKeys:  metadataKeys,
+		PollMetadata:  !c.allRecent,
+		Interval:      c.interval,
+		ExpiryWarning: c.expiryWarning,
+		OnError: func(err error) {
+			log.Println(err)
+		},
+	}
+	err := w.Run(ctx.Context)
+	if errors.Is(err, context.Canceled) {
+		// interrupted
+		return nil
+	}
+	return err
+}
+
+// selectKeys returns the metadata keys of the secrets given by args and, if
+// there are no args or -label is given, of the unexpired secrets in the
+// history of the profile and server of ctx whose label matches. A chunked secret is watched by its manifest,
+// listed first, which is retrieved or burned with the chunks.
+func (c *notifyCmd) selectKeys(ctx cmdContext, args []string) ([]string, error) {
+	var metadataKeys []string
+	for _, arg := range args {
+		keys, err := ots.ParseChunkedMetadataKey(arg)
+		if err != nil {
+			return nil, usageErr(err.Error())
+		}
+		metadataKeys = append(metadataKeys, keys[0])
+	}
+	if len(args) > 0 && c.label == "" {
+		return metadataKeys, nil
+	}
+
+	entries, err := loadHistory()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if !e.inContext(ctx) || !now.Before(e.SecretExpires) {
+			continue
+		}
+		if c.label != "" {
+			if ok, _ := path.Match(c.label, e.Label); !ok {
+				continue
+			}
+		}
+		keys, err := ots.ParseChunkedMetadataKey(e.MetadataKey)
+		if err != nil {
+			return nil, err
+		}
+		metadataKeys = append(metadataKeys, keys[0])
+	}
+	return metadataKeys, nil
+}
+
+func printEvent(e ots.Event, json bool) {
+	result := struct {
+		Time          time.Time
+		Event         string
+		MetadataKey   string
+		State         string
+		SecretExpires time.Time
+	}{e.Time.Round(time.Second), string(e.Type), e.Metadata.MetadataKey, string(e.Metadata.State), e.Metadata.SecretExpiresAt()}
+
+	printResult(result, json)
+	if json {
+		// separate the objects of the stream
+		fmt.Println()
+	}
+}
+
+// shellCommand returns a command that runs command with the system shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// commandNotifier runs a shell command for each event.
+type commandNotifier struct {
+	command string
+}
+
+func (n commandNotifier) Notify(ctx context.Context, e ots.Event) error {
+	cmd := shellCommand(ctx, n.command)
+
+	event, err := json.Marshal(e)
 	if err != nil {
 		return err
 	}
+	secretExpires := ""
+	if t := e.Metadata.SecretExpiresAt(); !t.IsZero() {
+		secretExpires = t.Format(time.RFC3339)
+	}
+	cmd.Env = append(os.Environ(),
+		"OTS_EVENT="+string(e.Type),
+		"OTS_METADATA_KEY="+e.Metadata.MetadataKey,
+		"OTS_STATE="+string(e.Metadata.State),
+		"OTS_SECRET_EXPIRES="+secretExpires,
+	)
+	cmd.Stdin = bytes.NewReader(event)
+	// keep stdout for events
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("-exec: %w", err)
+	}
+	return nil
+}
+
+// desktopNotifier shows a desktop notification for each event using
+// osascript on macOS or notify-send elsewhere.
+type desktopNotifier struct {
+}
+
+func desktopNotificationsSupported() bool {
+	return runtime.GOOS != "windows" && runtime.GOOS != "plan9" && runtime.GOOS != "js"
+}
+
+func (n desktopNotifier) Notify(ctx context.Context, e ots.Event) error {
+	title := "One-Time Secret"
+	var body string
+	switch e.Type {
+	case ots.EventExpiring:
+		body = fmt.Sprintf("Secret %v expires unread at %v", e.Metadata.MetadataKey, e.Metadata.SecretExpiresAt().Local().Format(time.Kitchen))
+	case ots.EventExpired:
+		body = fmt.Sprintf("Secret %v expired unread", e.Metadata.MetadataKey)
+	default:
+		body = fmt.Sprintf("Secret %v was %v", e.Metadata.MetadataKey, e.Type)
+	}
 
-	printResult(meta, ctx.JSON)
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		// AppleScript string literals share Go's quoting of ASCII text
+		script := fmt.Sprintf("display notification %q with title %q", body, title)
+		cmd = exec.CommandContext(ctx, "osascript", "-e", script)
+	} else {
+		cmd = exec.CommandContext(ctx, "notify-send", title, body)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("-desktop: %v: %s", err, bytes.TrimSpace(out))
+	}
 	return nil
 }
 
 type putCmd struct {
 	passphrase string
-	secretTTL  int
+	secretTTL  ttlValue
+	recipients recipientsValue
+	compress   bool
+	e2e        bool
+	urlOnly    bool
+	label      string
 }
 
 func (c *putCmd) AddFlags(flags *flag.FlagSet) {
 	flags.StringVar(&c.passphrase, "passphrase", "", "")
-	flags.IntVar(&c.secretTTL, "ttl", 0, "")
+	flags.Var(&c.secretTTL, "ttl", "")
+	flags.Var(&c.recipients, "recipient", "")
+	flags.BoolVar(&c.compress, "compress", false, "")
+	flags.BoolVar(&c.e2e, "e2e", false, "")
+	flags.BoolVar(&c.urlOnly, "url-only", false, "")
+	flags.StringVar(&c.label, "label", "", "")
 }
 
 func (c *putCmd) Run(ctx cmdContext, args []string) error {
 	if len(args) > 1 {
 		return usageErr("too many args")
 	}
+	if len(c.recipients) > 0 && (c.compress || c.e2e) {
+		// recipients open the emailed link in a browser, which can neither
+		// decompress nor decrypt the secret
+		return usageErr("-recipient cannot be combined with -compress or -e2e")
+	}
 
 	if c.passphrase == stdinArg {
 		if err := readSecretShort(&c.passphrase, "passphrase"); err != nil {
 			return err
 		}
 	}
+	if err := checkPassphrase(ctx, c.passphrase); err != nil {
+		return err
+	}
 
-	var secret string
+	var secret []byte
 	if len(args) > 0 {
-		secret = args[0]
+		secret = []byte(args[0])
 	} else {
 		if err := readSecretLong(&secret, "secret"); err != nil {
 			return err
 		}
 	}
+	defer ots.Wipe(secret)
+
+	ctx.Client.Compress = c.compress
+	opts := ots.PutOptions{Passphrase: c.passphrase, TTL: time.Duration(c.secretTTL)}
+
+	if len(c.recipients) > 0 {
+		type recipientResult struct {
+			SecretKey     string
+			MetadataKey   string
+			SecretExpires time.Time
+			SecretURL     string
+			MetadataURL   string
+			Recipient     string
+		}
+		results := []recipientResult{}
+		var urls []string
+		print := func() {
+			if c.urlOnly {
+				printURLs(urls, ctx.JSON)
+			} else {
+				printResult(results, ctx.JSON)
+			}
+		}
+		for _, recipient := range c.recipients {
+			// each recipient is emailed a link to one secret, so the secret
+			// is stored whole rather than in chunks
+			opts.Recipient = recipient
+			meta, err := ctx.Client.PutWithOptions(ctx.Context, secret, opts)
+			if err != nil {
+				// print the secrets already stored, which would otherwise be
+				// lost
+				print()
+				return err
+			}
+			secretURL, metadataURL := shareURLs(meta)
+			recordHistory(newHistoryEntry(ctx, meta, meta.MetadataKey, secretURL, metadataURL, c.label))
+			results = append(results, recipientResult{meta.SecretKey, meta.MetadataKey, meta.SecretExpiresAt(), secretURL, metadataURL, meta.ObfuscatedRecipient})
+			urls = append(urls, secretURL)
+		}
+		print()
+		return nil
+	}
+
+	return putSecret(ctx, secret, opts, c.e2e, c.urlOnly, c.label)
+}
+
+// putSecret stores a secret for put or put-file, records it in the history,
+// and prints the result.
+func putSecret(ctx cmdContext, secret []byte, opts ots.PutOptions, e2e bool, urlOnly bool, label string) error {
+	if e2e {
+		meta, secretURL, err := ctx.Client.EncryptedPutWithOptions(ctx.Context, secret, opts)
+		if err != nil {
+			return err
+		}
+		recordHistory(newHistoryEntry(ctx, meta, meta.MetadataKey, secretURL.String(), meta.MetadataURL().String(), label))
+
+		if urlOnly {
+			printURLs([]string{secretURL.String()}, ctx.JSON)
+			return nil
+		}
+
+		result := struct {
+			SecretURL     string
+			MetadataKey   string
+			SecretExpires time.Time
+			MetadataURL   string
+		}{secretURL.String(), meta.MetadataKey, meta.SecretExpiresAt(), meta.MetadataURL().String()}
 
-	meta, err := ctx.Client.Put(secret, c.passphrase, c.secretTTL, "")
+		printResult(result, ctx.JSON)
+		return nil
+	}
+
+	meta, err := ctx.Client.PutChunkedWithOptions(ctx.Context, secret, opts)
 	if err != nil {
 		return err
 	}
+	secretURL, metadataURL := shareURLs(meta.Metadata)
+	if len(meta.Chunks) > 0 {
+		// the metadata URL would identify only the manifest, not the chunks
+		metadataURL = ""
+	}
+	recordHistory(newHistoryEntry(ctx, meta.Metadata, meta.MetadataKey(), secretURL, metadataURL, label))
+
+	if urlOnly {
+		printURLs([]string{secretURL}, ctx.JSON)
+		return nil
+	}
 
 	result := struct {
-		SecretKey   string
-		MetadataKey string
-	}{meta.SecretKey, meta.MetadataKey}
+		SecretKey     string
+		MetadataKey   string
+		SecretExpires time.Time
+		SecretURL     string
+		MetadataURL   string
+	}{meta.Metadata.SecretKey, meta.MetadataKey(), meta.Metadata.SecretExpiresAt(), secretURL, metadataURL}
 
 	printResult(result, ctx.JSON)
 	return nil
 }
 
+type putFileCmd struct {
+	passphrase string
+	secretTTL  ttlValue
+	compress   bool
+	e2e        bool
+	urlOnly    bool
+	label      string
+}
+
+func (c *putFileCmd) AddFlags(flags *flag.FlagSet) {
+	flags.StringVar(&c.passphrase, "passphrase", "", "")
+	flags.Var(&c.secretTTL, "ttl", "")
+	flags.BoolVar(&c.compress, "compress", false, "")
+	flags.BoolVar(&c.e2e, "e2e", false, "")
+	flags.BoolVar(&c.urlOnly, "url-only", false, "")
+	flags.StringVar(&c.label, "label", "", "")
+}
+
+func (c *putFileCmd) Run(ctx cmdContext, args []string) error {
+	if len(args) < 1 {
+		return usageErr("missing arg: path")
+	} else if len(args) > 1 {
+		return usageErr("too many args")
+	}
+
+	if c.passphrase == stdinArg {
+		if err := readSecretShort(&c.passphrase, "passphrase"); err != nil {
+			return err
+		}
+	}
+	if err := checkPassphrase(ctx, c.passphrase); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(args[0])
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%v is not a regular file", args[0])
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	defer ots.Wipe(data)
+
+	secret, err := ots.EncodeFile(ots.File{Name: filepath.Base(args[0]), Mode: info.Mode().Perm(), Data: data})
+	if err != nil {
+		return err
+	}
+	defer ots.Wipe(secret)
+
+	ctx.Client.Compress = c.compress
+	opts := ots.PutOptions{Passphrase: c.passphrase, TTL: time.Duration(c.secretTTL)}
+	return putSecret(ctx, secret, opts, c.e2e, c.urlOnly, c.label)
+}
+
 type recentCmd struct {
 }
 
@@ -398,12 +1340,22 @@ func (c *recentCmd) Run(ctx cmdContext, args []string) error {
 		return usageErr("too many args")
 	}
 
-	metas, err := ctx.Client.GetRecentMetadata()
+	metas, err := ctx.Client.GetRecentMetadataContext(ctx.Context)
 	if err != nil {
 		return err
 	}
 
-	printResult(metas, ctx.JSON)
+	type recentResult struct {
+		ots.PartialMetadata
+		SecretExpires   time.Time
+		MetadataExpires time.Time
+	}
+	results := []recentResult{}
+	for _, meta := range metas {
+		results = append(results, recentResult{meta, meta.SecretExpiresAt(), meta.MetadataExpiresAt()})
+	}
+
+	printResult(results, ctx.JSON)
 	return nil
 }
 
@@ -418,7 +1370,7 @@ func (c *statusCmd) Run(ctx cmdContext, args []string) error {
 		return usageErr("too many args")
 	}
 
-	status, err := ctx.Client.GetSystemStatus()
+	status, err := ctx.Client.GetSystemStatusContext(ctx.Context)
 	if err != nil {
 		return err
 	}
@@ -431,6 +1383,53 @@ func (c *statusCmd) Run(ctx cmdContext, args []string) error {
 	return nil
 }
 
+type watchCmd struct {
+}
+
+func (c *watchCmd) AddFlags(flags *flag.FlagSet) {
+}
+
+func (c *watchCmd) Run(ctx cmdContext, args []string) error {
+	if len(args) < 1 {
+		return usageErr("missing arg: metadata-key or metadata-url")
+	} else if len(args) > 1 {
+		return usageErr("too many args")
+	}
+
+	keys, err := ots.ParseChunkedMetadataKey(args[0])
+	if err != nil {
+		return usageErr(err.Error())
+	}
+	// the manifest, listed first, is retrieved or burned with the chunks
+	metadataKey := keys[0]
+
+	meta, err := ctx.Client.WaitForState(ctx.Context, metadataKey)
+	expired := errors.Is(err, ots.ErrExpired)
+	if err != nil && !expired {
+		return err
+	}
+
+	result := struct {
+		MetadataKey string
+		State       string
+		Updated     time.Time
+	}{metadataKey, string(meta.State), meta.Updated}
+
+	var status exitStatus
+	if expired {
+		result.State = "expired"
+		status = 3
+	} else if meta.State == ots.SecretStateBurned {
+		status = 2
+	}
+
+	printResult(result, ctx.JSON)
+	if status != 0 {
+		return status
+	}
+	return nil
+}
+
 func contains(strings []string, s string) bool {
 	for _, t := range strings {
 		if s == t {
@@ -440,6 +1439,13 @@ func contains(strings []string, s string) bool {
 	return false
 }
 
+// isEncryptedURL reports whether s is a secret URL carrying a decryption key,
+// as printed by "ots put -e2e".
+func isEncryptedURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Host != "" && u.Fragment != ""
+}
+
 func findCmdType(name string) (cmdType, error) {
 	for _, t := range cmdTypes {
 		if t.Name == name {
@@ -449,30 +1455,145 @@ func findCmdType(name string) (cmdType, error) {
 	return cmdType{}, fmt.Errorf("unknown command: %v", name)
 }
 
-func getConfigPath() (string, error) {
-	dir, err := os.UserConfigDir()
+func parseBaseURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme in '%v'", s)
 	}
-	return filepath.Join(dir, relativeConfigPath), nil
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in '%v'", s)
+	}
+	return u, nil
+}
+
+// ttlValue is a flag holding a TTL. It accepts durations such as "1h30m",
+// with "d" for days, or a bare number of seconds.
+type ttlValue time.Duration
+
+func (v *ttlValue) String() string {
+	return time.Duration(*v).String()
 }
 
-func loadConfig() (config, error) {
-	path, err := getConfigPath()
+func (v *ttlValue) Set(s string) error {
+	d, err := parseTTL(s)
 	if err != nil {
-		return config{}, err
+		return err
+	}
+	*v = ttlValue(d)
+	return nil
+}
+
+// recipientsValue is a repeatable flag holding email addresses.
+type recipientsValue []string
+
+func (v *recipientsValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *recipientsValue) Set(s string) error {
+	if err := checkRecipient(s); err != nil {
+		return err
+	}
+	*v = append(*v, s)
+	return nil
+}
+
+// checkRecipient checks that s is a bare email address with a domain name.
+func checkRecipient(s string) error {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || !strings.Contains(s[strings.LastIndex(s, "@"):], ".") {
+		return fmt.Errorf("invalid email address %q", s)
+	}
+	return nil
+}
+
+// parseTTL parses a TTL such as "7d", "1d12h", "1h30m", or "3600" (seconds).
+func parseTTL(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second, nil
+	}
+
+	var d time.Duration
+	rest := s
+	if i := strings.Index(rest, "d"); i >= 0 {
+		days, err := strconv.Atoi(rest[:i])
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+		rest = rest[i+1:]
+		if rest == "" {
+			return d, nil
+		}
 	}
-	var cfg config
-	_, err = toml.DecodeFile(path, &cfg)
-	if err != nil && !errors.Is(err, fs.ErrNotExist) {
-		return config{}, fmt.Errorf("invalid config file '%v': %w", path, err)
+
+	r, err := time.ParseDuration(rest)
+	if err != nil || r < 0 {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+	return d + r, nil
+}
+
+// writeFile writes data to a file with the given permissions. Unless force is
+// true, it fails if the file exists.
+func writeFile(path string, data []byte, perm fs.FileMode, force bool) error {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	if perm == 0 {
+		perm = 0600
+	}
+
+	f, err := os.OpenFile(path, flag, perm)
+	if err != nil {
+		return err
+	}
+	// set the permissions explicitly, since OpenFile applies the umask and
+	// leaves the permissions of existing files unchanged
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeNewFile writes data to a new file named name or, if that exists, to
+// the first of name-1, name-2, ... (keeping any extension) that doesn't. It
+// returns the path written.
+func writeNewFile(name string, data []byte, perm fs.FileMode) (string, error) {
+	ext := filepath.Ext(name)
+	if ext == name {
+		// a dotfile such as .env has no extension
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+
+	path := name
+	for i := 1; ; i++ {
+		err := writeFile(path, data, perm, false)
+		if !errors.Is(err, fs.ErrExist) {
+			return path, err
+		}
+		path = fmt.Sprintf("%v-%v%v", base, i, ext)
 	}
-	return cfg, nil
 }
 
 func readSecretShort(v *string, prompt string) error {
 	if term.IsTerminal(int(os.Stdin.Fd())) {
-		return readSecretFromTerminal(v, prompt)
+		b, err := readSecretFromTerminal(prompt)
+		if err != nil {
+			return err
+		}
+		*v = string(b)
+		return nil
 	} else {
 		scanner := bufio.NewScanner(os.Stdin)
 		if !scanner.Scan() {
@@ -485,28 +1606,64 @@ func readSecretShort(v *string, prompt string) error {
 	}
 }
 
-func readSecretLong(v *string, prompt string) error {
+// readSecretLong reads a secret into a byte slice, which the caller should
+// wipe when finished with it.
+func readSecretLong(v *[]byte, prompt string) error {
 	if term.IsTerminal(int(os.Stdin.Fd())) {
-		return readSecretFromTerminal(v, prompt)
+		b, err := readSecretFromTerminal(prompt)
+		if err != nil {
+			return err
+		}
+		*v = b
+		return nil
 	} else {
-		bytes, err := io.ReadAll(os.Stdin)
+		var buf bytes.Buffer
+		// read into a buffer sized for the whole secret, so that it is not
+		// copied as the buffer grows
+		if info, err := os.Stdin.Stat(); err == nil && info.Mode().IsRegular() {
+			buf.Grow(int(info.Size()) + bytes.MinRead)
+		}
+		_, err := buf.ReadFrom(os.Stdin)
 		if err != nil {
+			ots.Wipe(buf.Bytes())
 			return err
 		}
-		*v = string(bytes)
+		*v = buf.Bytes()
 		return nil
 	}
 }
 
-func readSecretFromTerminal(v *string, prompt string) error {
+func readSecretFromTerminal(prompt string) ([]byte, error) {
 	fmt.Printf("%v: ", prompt)
-	bytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
 	fmt.Println("")
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return b, nil
+}
+
+// shareURLs returns the secret URL and metadata URL of a new secret.
+func shareURLs(meta ots.Metadata) (string, string) {
+	secretURL := ""
+	if u, err := meta.SecretURL(); err == nil {
+		secretURL = u.String()
+	}
+	return secretURL, meta.MetadataURL().String()
+}
+
+// printURLs prints secret URLs for -url-only, one per line or, with -json, as
+// a JSON string or, if there are several, an array.
+func printURLs(urls []string, json bool) {
+	if !json {
+		for _, u := range urls {
+			fmt.Println(u)
+		}
+	} else if len(urls) == 1 {
+		printResult(urls[0], json)
+	} else {
+		printResult(urls, json)
 	}
-	*v = string(bytes)
-	return nil
 }
 
 func printResult(v interface{}, json bool) {
@@ -524,41 +1681,74 @@ func printResultPlain(v interface{}) {
 
 	if val.Type() == reflect.TypeOf(time.Time{}) {
 		t := val.Interface().(time.Time)
-		fmt.Print(t.Format(time.RFC3339))
+		if !t.IsZero() {
+			fmt.Print(t.Format(time.RFC3339))
+		}
 	} else if val.Kind() == reflect.Slice {
 		for i := 0; i < val.Len(); i++ {
 			printResultPlain(val.Index(i).Interface())
 		}
 	} else if val.Kind() == reflect.Struct {
-		for i := 0; i < val.NumField(); i++ {
-			if i > 0 {
-				fmt.Print("\t")
-			}
-			printResultPlain(val.Field(i).Interface())
-		}
+		printFieldsPlain(val, 0)
 		fmt.Print("\n")
 	} else {
 		fmt.Print(val)
 	}
 }
 
+// printFieldsPlain prints the exported fields of a struct separated by tabs,
+// including the fields of embedded structs, and returns the number of fields
+// printed so far.
+func printFieldsPlain(val reflect.Value, printed int) int {
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			printed = printFieldsPlain(val.Field(i), printed)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if printed > 0 {
+			fmt.Print("\t")
+		}
+		printResultPlain(val.Field(i).Interface())
+		printed++
+	}
+	return printed
+}
+
 func printResultJSON(v interface{}) error {
 	json, err := json.MarshalIndent(v, "", "\t")
 	if err != nil {
 		return err
 	}
-	fmt.Print(string(json))
-	return nil
+	defer ots.Wipe(json)
+	_, err = os.Stdout.Write(json)
+	return err
 }
 
 func usage(cmd string, cmdArgs string) string {
-	s := fmt.Sprintf("Usage: ots %v [-username <string>] [-key <string>] [-json]", cmd)
+	s := fmt.Sprintf("Usage: ots %v [-profile <name>] [-username <string>] [-key <string>] [-anonymous] [-url <string>] [-timeout <duration>] [-json]", cmd)
 	if len(cmdArgs) > 0 {
 		s += " " + cmdArgs
 	}
 	return s
 }
 
+// joinList joins items into an English list such as "a, b, and c".
+func joinList(items []string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	case 2:
+		return items[0] + " and " + items[1]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + ", and " + items[len(items)-1]
+}
+
 func printHelp(w io.Writer) {
 	configPath, err := getConfigPath()
 	if err != nil {
@@ -582,11 +1772,45 @@ func printHelp(w io.Writer) {
 	fmt.Fprintln(w, "Run \"ots help <command>\" for help on each command.")
 	fmt.Fprintln(w, "")
 
-	fmt.Fprintf(w, "ots requires a username and API key from onetimesecret.com. Provide these with the -username and -key options, in the environment variables OTS_USERNAME and OTS_KEY, or in the config file \"%v\". For example:\n", configPath)
+	var authCmds []string
+	for _, t := range cmdTypes {
+		if t.RequiresAuth {
+			authCmds = append(authCmds, t.Name)
+		}
+	}
+	fmt.Fprintf(w, "The %v commands require a username and API key from onetimesecret.com. Provide these with the -username and -key options, in the environment variables OTS_USERNAME and OTS_KEY, or in the config file \"%v\". For example:\n", joinList(authCmds), configPath)
 	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "  username = \"my-username\"")
 	fmt.Fprintln(w, "  key = \"my-key\"")
 	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Rather than storing the key in the config file, you can store it in a file or a password manager and give its path or a command that prints it:")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "  key_file = \"~/.ots-key\"")
+	fmt.Fprintln(w, "  key_command = \"pass show ots\"")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "\"ots login\" prompts for a username and key, verifies them, and saves them to the config file. Other users may see the -key option in the process list, so prefer the config file or OTS_KEY on shared machines.")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Other commands work anonymously when no credentials are provided. To ignore configured credentials, specify -anonymous.")
+	fmt.Fprintln(w, "")
+
+	fmt.Fprintln(w, "To use a self-hosted or regional One-Time Secret server, provide its base URL with the -url option, in the environment variable OTS_URL, or in the config file, for example:")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "  url = \"https://eu.onetimesecret.com\"")
+	fmt.Fprintln(w, "")
 
+	fmt.Fprintln(w, "To switch between accounts or servers, add named profiles to the config file and select one with the -profile option or the environment variable OTS_PROFILE, or by default with \"ots config use\". For example:")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "  [profiles.team]")
+	fmt.Fprintln(w, "  username = \"team-username\"")
+	fmt.Fprintln(w, "  key = \"team-key\"")
+	fmt.Fprintln(w, "  ttl = \"1d\"")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Run \"ots help config\" for details.")
+	fmt.Fprintln(w, "")
+
+	fmt.Fprintln(w, "The -ttl option of gen, put, and put-file accepts durations such as \"7d\", \"1h30m\", or \"90s\", or a number of seconds.")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "If -timeout is specified (for example, \"30s\"), ots gives up if the command takes longer than the given duration. The duration covers the whole command, including time spent waiting at prompts for a passphrase or secret, not each request.")
+	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "If -json is specified, ots prints JSON.")
 }
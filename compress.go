@@ -0,0 +1,134 @@
+package onetimesecret
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// compressedPrefix marks a secret compressed by the client. It is followed by
+// the base64-encoded gzip stream.
+const compressedPrefix = "ots-gzip:v1:"
+
+// DefaultMaxCompressionRatio is the compression ratio limit the client uses if
+// Client.MaxCompressionRatio is zero.
+const DefaultMaxCompressionRatio = 100
+
+// ErrCompressionRatio is returned when a compressed secret would decompress to
+// more than the client's MaxCompressionRatio times its stored size. The secret
+// has been destroyed.
+var ErrCompressionRatio = errors.New("onetimesecret: compression ratio exceeds limit")
+
+// WithCompression causes the client to compress secrets it stores when that
+// makes them smaller.
+func WithCompression() Option {
+	return func(c *Client) {
+		c.Compress = true
+	}
+}
+
+// WithMaxCompressionRatio sets how many times larger than a stored secret its
+// decompressed contents may be.
+func WithMaxCompressionRatio(n int) Option {
+	return func(c *Client) {
+		c.MaxCompressionRatio = n
+	}
+}
+
+func (c *Client) maxCompressionRatio() int {
+	if c.MaxCompressionRatio <= 0 {
+		return DefaultMaxCompressionRatio
+	}
+	return c.MaxCompressionRatio
+}
+
+// IsCompressed reports whether a secret retrieved as stored was compressed by
+// the client.
+func IsCompressed(secret []byte) bool {
+	return bytes.HasPrefix(secret, []byte(compressedPrefix))
+}
+
+// compress returns secret compressed with gzip and reports whether the
+// compressed form, including its prefix and base64 encoding, is smaller. It
+// also reports false if the compressed form would exceed the client's ratio
+// limit, so that the secret can be retrieved by a client with the same limit.
+func (c *Client) compress(secret []byte) ([]byte, bool, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := w.Write(secret); err != nil {
+		return nil, false, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, false, err
+	}
+	defer Wipe(buf.Bytes())
+
+	n := len(compressedPrefix) + base64.StdEncoding.EncodedLen(buf.Len())
+	if n >= len(secret) || len(secret) > n*c.maxCompressionRatio() {
+		return nil, false, nil
+	}
+	b := make([]byte, n)
+	i := copy(b, compressedPrefix)
+	base64.StdEncoding.Encode(b[i:], buf.Bytes())
+	return b, true, nil
+}
+
+// decompress returns secret decompressed if it was compressed by the client,
+// wiping the compressed form, and returns secret unchanged otherwise.
+func (c *Client) decompress(secret []byte) ([]byte, error) {
+	if !IsCompressed(secret) {
+		return secret, nil
+	}
+	defer Wipe(secret)
+
+	encoded := secret[len(compressedPrefix):]
+	gz := make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+	defer Wipe(gz)
+	n, err := base64.StdEncoding.Decode(gz, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("onetimesecret: invalid compressed secret: %v", err)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(gz[:n]))
+	if err != nil {
+		return nil, fmt.Errorf("onetimesecret: invalid compressed secret: %v", err)
+	}
+	out, err := readAll(r, len(secret)*c.maxCompressionRatio())
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// readAll reads from r until EOF and returns the data read. It fails with
+// ErrCompressionRatio if r yields more than limit bytes. Unlike io.ReadAll, it
+// wipes the buffers it outgrows.
+func readAll(r io.Reader, limit int) ([]byte, error) {
+	b := make([]byte, 0, 512)
+	for {
+		if len(b) == cap(b) {
+			grown := make([]byte, len(b), 2*cap(b))
+			copy(grown, b)
+			Wipe(b)
+			b = grown
+		}
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if len(b) > limit {
+			Wipe(b)
+			return nil, ErrCompressionRatio
+		}
+		if err == io.EOF {
+			return b, nil
+		} else if err != nil {
+			Wipe(b)
+			return nil, fmt.Errorf("onetimesecret: invalid compressed secret: %v", err)
+		}
+	}
+}
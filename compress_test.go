@@ -0,0 +1,109 @@
+package onetimesecret
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGetCompressed(t *testing.T) {
+	c, srv := newTestClient(t, WithCompression())
+	want := strings.Repeat("API_KEY=abc123\n", 100)
+	meta, err := c.Put(want, "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	stored, ok := srv.Secret(meta.SecretKey)
+	if !ok {
+		t.Fatalf("secret %v not stored", meta.SecretKey)
+	}
+	if !IsCompressed([]byte(stored)) || len(stored) >= len(want) {
+		t.Errorf("server stored %v bytes uncompressed (want compressed)", len(stored))
+	}
+
+	got, err := c.Get(meta.SecretKey, "")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("got secret %q (want %q)", got, want)
+	}
+}
+
+func TestPutIncompressible(t *testing.T) {
+	c, srv := newTestClient(t, WithCompression())
+	want := randStr()
+	meta, err := c.Put(want, "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if stored, _ := srv.Secret(meta.SecretKey); stored != want {
+		t.Errorf("server stored %q (want %q)", stored, want)
+	}
+}
+
+func TestGetCompressionRatio(t *testing.T) {
+	c, srv := newTestClient(t, WithCompression())
+	meta, err := c.Put(strings.Repeat("a", 100000), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if stored, _ := srv.Secret(meta.SecretKey); IsCompressed([]byte(stored)) {
+		t.Errorf("secret compressed beyond the ratio limit")
+	}
+
+	c.MaxCompressionRatio = 1000
+	meta, err = c.Put(strings.Repeat("a", 100000), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	c.MaxCompressionRatio = 10
+	_, err = c.Get(meta.SecretKey, "")
+	if !errors.Is(err, ErrCompressionRatio) {
+		t.Errorf("got error %v (want %v)", err, ErrCompressionRatio)
+	}
+}
+
+func TestGetChunkedCompressed(t *testing.T) {
+	c, _ := newTestClient(t, WithCompression(), WithChunkSize(1000))
+	var want []byte
+	for i := 0; i < 1000; i++ {
+		want = append(want, fmt.Sprintf(`{"type": "service_account", "project_id": "project-%d"}`, i)...)
+	}
+	meta, err := c.PutChunked(want, "", 0, "")
+	if err != nil {
+		t.Fatalf("put chunked failed: %v", err)
+	}
+	if n := len(want) / 1000; len(meta.Chunks) >= n {
+		t.Errorf("got %v chunks (want fewer than %v)", len(meta.Chunks), n)
+	}
+	got, err := c.GetChunked(meta.Metadata.SecretKey, "")
+	if err != nil {
+		t.Fatalf("get chunked failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got secret of %v bytes (want %v)", len(got), len(want))
+	}
+}
+
+func TestEncryptedGetCompressed(t *testing.T) {
+	c, srv := newTestClient(t, WithCompression())
+	want := strings.Repeat("the launch codes ", 100)
+	meta, shareURL, err := c.EncryptedPut(want, "", 0, "")
+	if err != nil {
+		t.Fatalf("encrypted put failed: %v", err)
+	}
+	if stored, _ := srv.Secret(meta.SecretKey); len(stored) >= len(want) {
+		t.Errorf("server stored %v bytes (want fewer than %v)", len(stored), len(want))
+	}
+	got, err := c.EncryptedGet(shareURL.String(), "")
+	if err != nil {
+		t.Fatalf("encrypted get failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("got secret %q (want %q)", got, want)
+	}
+}
@@ -0,0 +1,234 @@
+package onetimesecret
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// encryptedPrefix marks a secret stored by EncryptedPut. The rest of the
+// secret is the base64-encoded nonce and AES-256-GCM ciphertext.
+const encryptedPrefix = "ots-e2e:v1:"
+
+const encryptionKeySize = 32
+
+// ErrNotEncrypted is returned by EncryptedGet when the secret was not stored
+// by EncryptedPut. The secret has been destroyed.
+var ErrNotEncrypted = errors.New("onetimesecret: secret is not end-to-end encrypted")
+
+// ErrDecrypt is returned by EncryptedGet when the secret cannot be decrypted
+// with the key in the share URL. The secret has been destroyed.
+var ErrDecrypt = errors.New("onetimesecret: cannot decrypt secret")
+
+// EncryptedPut encrypts a secret locally with a new random key and stores only
+// the ciphertext, so the server never sees the plaintext. It returns the new
+// secret's metadata and a share URL whose fragment holds the key. Browsers do
+// not send URL fragments to the server, but anyone with the full share URL can
+// decrypt the secret with EncryptedGet.
+//
+// Secrets stored with EncryptedPut cannot be read in the One-Time Secret web
+// interface, which shows only the ciphertext.
+func (c *Client) EncryptedPut(secret string, passphrase string, secretTTL int, recipient string) (Metadata, *url.URL, error) {
+	return c.EncryptedPutContext(context.Background(), secret, passphrase, secretTTL, recipient)
+}
+
+// EncryptedPutContext is like EncryptedPut but uses ctx for the request.
+func (c *Client) EncryptedPutContext(ctx context.Context, secret string, passphrase string, secretTTL int, recipient string) (Metadata, *url.URL, error) {
+	b := []byte(secret)
+	defer Wipe(b)
+	return c.EncryptedPutBytesContext(ctx, b, passphrase, secretTTL, recipient)
+}
+
+// EncryptedPutBytes is like EncryptedPut but takes the secret in a byte slice,
+// which the caller can overwrite when EncryptedPutBytes returns.
+func (c *Client) EncryptedPutBytes(secret []byte, passphrase string, secretTTL int, recipient string) (Metadata, *url.URL, error) {
+	return c.EncryptedPutBytesContext(context.Background(), secret, passphrase, secretTTL, recipient)
+}
+
+// EncryptedPutBytesContext is like EncryptedPutBytes but uses ctx for the
+// request.
+func (c *Client) EncryptedPutBytesContext(ctx context.Context, secret []byte, passphrase string, secretTTL int, recipient string) (Metadata, *url.URL, error) {
+	return c.EncryptedPutWithOptions(ctx, secret, positionalOptions(passphrase, secretTTL, recipient))
+}
+
+// EncryptedPutWithOptions is like EncryptedPutBytesContext but takes optional
+// parameters in a PutOptions.
+func (c *Client) EncryptedPutWithOptions(ctx context.Context, secret []byte, opts PutOptions) (Metadata, *url.URL, error) {
+	if len(secret) == 0 {
+		return Metadata{}, nil, ErrInvalid
+	}
+
+	// compress before encrypting, since ciphertext does not compress
+	if c.Compress {
+		compressed, ok, err := c.compress(secret)
+		if err != nil {
+			return Metadata{}, nil, err
+		}
+		if ok {
+			defer Wipe(compressed)
+			secret = compressed
+		}
+	}
+
+	key := make([]byte, encryptionKeySize)
+	defer Wipe(key)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return Metadata{}, nil, err
+	}
+
+	sealed, err := seal(key, secret)
+	if err != nil {
+		return Metadata{}, nil, err
+	}
+
+	m, err := c.putBytes(ctx, []byte(sealed), opts)
+	if err != nil {
+		return Metadata{}, nil, err
+	}
+
+	u, err := m.SecretURL()
+	if err != nil {
+		return Metadata{}, nil, err
+	}
+	u.Fragment = base64.RawURLEncoding.EncodeToString(key)
+
+	return m, u, nil
+}
+
+// EncryptedGet retrieves and decrypts a secret stored by EncryptedPut given
+// its share URL and, if necessary, a passphrase. The request is sent to the
+// client's server regardless of the host in the share URL. If there is no
+// such secret or the passphrase is incorrect, EncryptedGet returns
+// ErrNotFound.
+func (c *Client) EncryptedGet(shareURL string, passphrase string) (string, error) {
+	return c.EncryptedGetContext(context.Background(), shareURL, passphrase)
+}
+
+// EncryptedGetContext is like EncryptedGet but uses ctx for the request.
+func (c *Client) EncryptedGetContext(ctx context.Context, shareURL string, passphrase string) (string, error) {
+	b, err := c.EncryptedGetBytesContext(ctx, shareURL, passphrase)
+	if err != nil {
+		return "", err
+	}
+	defer Wipe(b)
+	return string(b), nil
+}
+
+// EncryptedGetBytes is like EncryptedGet but returns the secret in a byte
+// slice, which the caller can overwrite when finished with it.
+func (c *Client) EncryptedGetBytes(shareURL string, passphrase string) ([]byte, error) {
+	return c.EncryptedGetBytesContext(context.Background(), shareURL, passphrase)
+}
+
+// EncryptedGetBytesContext is like EncryptedGetBytes but uses ctx for the
+// request.
+func (c *Client) EncryptedGetBytesContext(ctx context.Context, shareURL string, passphrase string) ([]byte, error) {
+	secretKey, key, err := parseEncryptedURL(shareURL)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(key)
+
+	sealed, err := c.getBytes(ctx, secretKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := open(key, string(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return c.decompress(secret)
+}
+
+// IsEncrypted reports whether a secret retrieved with Get was stored by
+// EncryptedPut.
+func IsEncrypted(secret string) bool {
+	return strings.HasPrefix(secret, encryptedPrefix)
+}
+
+// IsEncryptedBytes is like IsEncrypted but takes a secret retrieved with
+// GetBytes.
+func IsEncryptedBytes(secret []byte) bool {
+	return bytes.HasPrefix(secret, []byte(encryptedPrefix))
+}
+
+// parseEncryptedURL returns the secret key and encryption key in a share URL
+// returned by EncryptedPut.
+func parseEncryptedURL(shareURL string) (string, []byte, error) {
+	secretKey, err := ParseSecretURL(shareURL)
+	if err != nil {
+		return "", nil, err
+	}
+	u, err := url.Parse(shareURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if u.Fragment == "" {
+		return "", nil, fmt.Errorf("%w: share URL has no encryption key", ErrInvalid)
+	}
+	key, err := base64.RawURLEncoding.DecodeString(u.Fragment)
+	if err != nil || len(key) != encryptionKeySize {
+		return "", nil, fmt.Errorf("%w: share URL has an invalid encryption key", ErrInvalid)
+	}
+
+	return secretKey, key, nil
+}
+
+func seal(key []byte, plaintext []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(encryptedPrefix))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func open(key []byte, secret string) ([]byte, error) {
+	if !IsEncrypted(secret) {
+		return nil, ErrNotEncrypted
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, encryptedPrefix))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(encryptedPrefix))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
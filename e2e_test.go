@@ -0,0 +1,97 @@
+package onetimesecret
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedGet(t *testing.T) {
+	c, srv := newTestClient(t)
+	want := "the launch codes"
+	meta, shareURL, err := c.EncryptedPut(want, "", 0, "")
+	if err != nil {
+		t.Fatalf("encrypted put failed: %v", err)
+	}
+	if shareURL.Fragment == "" {
+		t.Errorf("share URL %v has no key fragment", shareURL)
+	}
+
+	stored, ok := srv.Secret(meta.SecretKey)
+	if !ok {
+		t.Fatalf("secret %v not stored", meta.SecretKey)
+	}
+	if strings.Contains(stored, want) || !IsEncrypted(stored) {
+		t.Errorf("server stored %q (want ciphertext)", stored)
+	}
+
+	got, err := c.EncryptedGet(shareURL.String(), "")
+	if err != nil {
+		t.Fatalf("encrypted get failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("got secret %v (want %v)", got, want)
+	}
+}
+
+func TestEncryptedGetWrongKey(t *testing.T) {
+	c, _ := newTestClient(t)
+	_, shareURL, err := c.EncryptedPut(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("encrypted put failed: %v", err)
+	}
+	_, otherURL, err := c.EncryptedPut(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("encrypted put failed: %v", err)
+	}
+
+	shareURL.Fragment = otherURL.Fragment
+	_, err = c.EncryptedGet(shareURL.String(), "")
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("got error %v (want %v)", err, ErrDecrypt)
+	}
+}
+
+func TestEncryptedGetNotEncrypted(t *testing.T) {
+	c, _ := newTestClient(t)
+	_, shareURL, err := c.EncryptedPut(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("encrypted put failed: %v", err)
+	}
+	meta, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	plainURL, err := meta.SecretURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainURL.Fragment = shareURL.Fragment
+	_, err = c.EncryptedGet(plainURL.String(), "")
+	if !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("got error %v (want %v)", err, ErrNotEncrypted)
+	}
+}
+
+func TestEncryptedGetMissingKey(t *testing.T) {
+	c, _ := newTestClient(t)
+	meta, shareURL, err := c.EncryptedPut(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("encrypted put failed: %v", err)
+	}
+	shareURL.Fragment = ""
+	_, err = c.EncryptedGet(shareURL.String(), "")
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("got error %v (want %v)", err, ErrInvalid)
+	}
+
+	// the secret must not have been retrieved
+	meta, err = c.GetMetadata(meta.MetadataKey)
+	if err != nil {
+		t.Fatalf("get metadata failed: %v", err)
+	}
+	if meta.State == SecretStateReceived {
+		t.Errorf("secret was retrieved without a key")
+	}
+}
@@ -0,0 +1,165 @@
+package onetimesecret
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// filePrefix marks a secret stored by PutFile. It is followed by a JSON header
+// line and the base64-encoded file contents.
+const filePrefix = "ots-file:v1:"
+
+// ErrNotFile is returned by GetFile and DecodeFile when a secret is not a file
+// envelope. The secret has been destroyed.
+var ErrNotFile = errors.New("onetimesecret: secret is not a file")
+
+// ErrChecksum is returned by GetFile, DecodeFile, and GetChunked when a
+// retrieved file or secret does not match the size and SHA-256 checksum
+// recorded when it was stored. The secret has been destroyed.
+var ErrChecksum = errors.New("onetimesecret: checksum mismatch")
+
+// A File is a file stored as a secret.
+type File struct {
+	// Name is the file's base name, without any directory.
+	Name string
+
+	// Mode holds the file's permission bits.
+	Mode fs.FileMode
+
+	Data []byte
+}
+
+type fileHeader struct {
+	Name   string `json:"name"`
+	Mode   uint32 `json:"mode"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// EncodeFile encodes a file as text that can be stored as a secret. The
+// encoding records the file's name, permission bits, size, and SHA-256
+// checksum. Only the base name of f.Name is kept.
+func EncodeFile(f File) ([]byte, error) {
+	name, err := fileBaseName(f.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(f.Data)
+	header, err := json.Marshal(fileHeader{
+		Name:   name,
+		Mode:   uint32(f.Mode.Perm()),
+		Size:   len(f.Data),
+		SHA256: hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(filePrefix) + len(header) + 1 + base64.StdEncoding.EncodedLen(len(f.Data))
+	b := make([]byte, n)
+	i := copy(b, filePrefix)
+	i += copy(b[i:], header)
+	b[i] = '\n'
+	base64.StdEncoding.Encode(b[i+1:], f.Data)
+	return b, nil
+}
+
+// DecodeFile decodes a secret encoded by EncodeFile. It returns ErrNotFile if
+// the secret is not a file envelope and ErrChecksum if the file's contents do
+// not match the recorded size and checksum.
+func DecodeFile(secret []byte) (File, error) {
+	if !IsFile(secret) {
+		return File{}, ErrNotFile
+	}
+	rest := secret[len(filePrefix):]
+
+	i := bytes.IndexByte(rest, '\n')
+	if i < 0 {
+		return File{}, fmt.Errorf("%w: missing header", ErrNotFile)
+	}
+	var header fileHeader
+	if err := json.Unmarshal(rest[:i], &header); err != nil {
+		return File{}, fmt.Errorf("%w: invalid header: %v", ErrNotFile, err)
+	}
+	name, err := fileBaseName(header.Name)
+	if err != nil || name != header.Name {
+		return File{}, fmt.Errorf("%w: invalid file name %q", ErrNotFile, header.Name)
+	}
+
+	encoded := rest[i+1:]
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+	n, err := base64.StdEncoding.Decode(data, encoded)
+	if err != nil {
+		Wipe(data)
+		return File{}, fmt.Errorf("%w: invalid contents: %v", ErrNotFile, err)
+	}
+	data = data[:n]
+
+	sum := sha256.Sum256(data)
+	want, err := hex.DecodeString(header.SHA256)
+	if err != nil || len(data) != header.Size || subtle.ConstantTimeCompare(sum[:], want) != 1 {
+		Wipe(data)
+		return File{}, ErrChecksum
+	}
+
+	return File{Name: name, Mode: fs.FileMode(header.Mode).Perm(), Data: data}, nil
+}
+
+// IsFile reports whether a secret was encoded by EncodeFile.
+func IsFile(secret []byte) bool {
+	return bytes.HasPrefix(secret, []byte(filePrefix))
+}
+
+// PutFile stores a file as a secret. See EncodeFile.
+func (c *Client) PutFile(f File, passphrase string, secretTTL int, recipient string) (Metadata, error) {
+	return c.PutFileContext(context.Background(), f, passphrase, secretTTL, recipient)
+}
+
+// PutFileContext is like PutFile but uses ctx for the request.
+func (c *Client) PutFileContext(ctx context.Context, f File, passphrase string, secretTTL int, recipient string) (Metadata, error) {
+	secret, err := EncodeFile(f)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer Wipe(secret)
+	return c.PutBytesContext(ctx, secret, passphrase, secretTTL, recipient)
+}
+
+// GetFile retrieves a file stored by PutFile. If the file's contents do not
+// match the checksum recorded by PutFile, GetFile returns ErrChecksum; the
+// secret has been destroyed regardless.
+func (c *Client) GetFile(secretKey string, passphrase string) (File, error) {
+	return c.GetFileContext(context.Background(), secretKey, passphrase)
+}
+
+// GetFileContext is like GetFile but uses ctx for the request.
+func (c *Client) GetFileContext(ctx context.Context, secretKey string, passphrase string) (File, error) {
+	secret, err := c.GetBytesContext(ctx, secretKey, passphrase)
+	if err != nil {
+		return File{}, err
+	}
+	defer Wipe(secret)
+	return DecodeFile(secret)
+}
+
+// fileBaseName returns the last element of name, which may use slashes or
+// backslashes as separators.
+func fileBaseName(name string) (string, error) {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("%w: invalid file name", ErrInvalid)
+	}
+	return name, nil
+}
@@ -0,0 +1,77 @@
+package onetimesecret
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestGetFile(t *testing.T) {
+	c, _ := newTestClient(t)
+	want := File{Name: "id_ed25519", Mode: 0600, Data: []byte{0, 1, 2, 0xff, '\n', 'x'}}
+	meta, err := c.PutFile(want, "", 0, "")
+	if err != nil {
+		t.Fatalf("put file failed: %v", err)
+	}
+
+	got, err := c.GetFile(meta.SecretKey, "")
+	if err != nil {
+		t.Fatalf("get file failed: %v", err)
+	}
+	if got.Name != want.Name || got.Mode != want.Mode || !bytes.Equal(got.Data, want.Data) {
+		t.Errorf("got file %+v (want %+v)", got, want)
+	}
+}
+
+func TestGetFileNotFile(t *testing.T) {
+	c, _ := newTestClient(t)
+	meta, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	_, err = c.GetFile(meta.SecretKey, "")
+	if !errors.Is(err, ErrNotFile) {
+		t.Errorf("got error %v (want %v)", err, ErrNotFile)
+	}
+}
+
+func TestEncodeFile(t *testing.T) {
+	b, err := EncodeFile(File{Name: "/etc/ssl/bundle.pem", Mode: fs.ModeDir | 0644, Data: []byte("pem")})
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	f, err := DecodeFile(b)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if f.Name != "bundle.pem" {
+		t.Errorf("got name %v (want %v)", f.Name, "bundle.pem")
+	}
+	if f.Mode != 0644 {
+		t.Errorf("got mode %v (want %v)", f.Mode, fs.FileMode(0644))
+	}
+
+	if _, err := EncodeFile(File{Name: "dir/", Data: []byte("x")}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("got error %v (want %v)", err, ErrInvalid)
+	}
+}
+
+func TestDecodeFileChecksum(t *testing.T) {
+	b, err := EncodeFile(File{Name: "a.txt", Mode: 0644, Data: []byte("hello, world")})
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	// "hello, world" encodes to "aGVsbG8sIHdvcmxk"; change its last byte
+	b[len(b)-1] = 'j'
+	if _, err := DecodeFile(b); !errors.Is(err, ErrChecksum) {
+		t.Errorf("got error %v (want %v)", err, ErrChecksum)
+	}
+}
+
+func TestDecodeFileInvalidName(t *testing.T) {
+	secret := []byte(filePrefix + `{"name":"../.bashrc","mode":420,"size":0,"sha256":""}` + "\n")
+	if _, err := DecodeFile(secret); !errors.Is(err, ErrNotFile) {
+		t.Errorf("got error %v (want %v)", err, ErrNotFile)
+	}
+}
@@ -0,0 +1,312 @@
+package onetimesecret
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const defaultWatchInterval = time.Minute
+
+// An EventType identifies a change in a secret observed by a Watcher.
+type EventType string
+
+const (
+	// EventViewed means the secret's metadata was viewed.
+	EventViewed EventType = "viewed"
+
+	// EventReceived means the secret was retrieved.
+	EventReceived EventType = "received"
+
+	// EventBurned means the secret was burned.
+	EventBurned EventType = "burned"
+
+	// EventExpiring means the secret has not been retrieved and will expire
+	// within the watcher's ExpiryWarning.
+	EventExpiring EventType = "expiring"
+
+	// EventExpired means the secret expired without being retrieved.
+	EventExpired EventType = "expired"
+)
+
+// An Event is a change in a secret observed by a Watcher.
+type Event struct {
+	Type EventType
+
+	// Metadata is the secret's metadata as last retrieved.
+	Metadata PartialMetadata
+
+	// Previous is the secret's state before the change.
+	Previous SecretState
+
+	// Time is when the watcher observed the change.
+	Time time.Time
+}
+
+// A Notifier is notified of events observed by a Watcher.
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// NotifierFunc adapts a function to a Notifier.
+type NotifierFunc func(ctx context.Context, e Event) error
+
+// Notify calls f(ctx, e).
+func (f NotifierFunc) Notify(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// MultiNotifier returns a Notifier that notifies each of notifiers in turn.
+// It returns the first error, after notifying the rest.
+func MultiNotifier(notifiers ...Notifier) Notifier {
+	return NotifierFunc(func(ctx context.Context, e Event) error {
+		var firstErr error
+		for _, n := range notifiers {
+			if err := n.Notify(ctx, e); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	})
+}
+
+// A WebhookNotifier posts each event as JSON to a URL.
+type WebhookNotifier struct {
+	URL string
+
+	// HTTPClient is used to post events. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// Notify posts e to n.URL. It returns an error if the response status is not
+// 2xx.
+func (n *WebhookNotifier) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("onetimesecret: webhook %v: %v", n.URL, resp.Status)
+	}
+	return nil
+}
+
+// A Watcher polls the metadata of recently created secrets and notifies a
+// Notifier when they are viewed, received, or burned, when they are about to
+// expire unread, and when they expire.
+//
+// The first poll records the state of the secrets it finds without notifying
+// of past changes. Secrets created later are watched from creation.
+//
+// By default, a Watcher polls with GetRecentMetadata, since polling
+// GetMetadata would mark new secrets viewed, so its Client needs credentials.
+// Set PollMetadata to watch secrets, including anonymous ones, without them.
+type Watcher struct {
+	Client   *Client
+	Notifier Notifier
+
+	// MetadataKeys, if not empty, limits the watcher to the secrets with
+	// these metadata keys.
+	MetadataKeys []string
+
+	// PollMetadata, if true, causes the watcher to poll each of MetadataKeys
+	// with GetMetadata rather than listing recent secrets, so that its Client
+	// needs no credentials. Since the polling itself marks new secrets
+	// viewed, the watcher does not notify of EventViewed.
+	PollMetadata bool
+
+	// Interval is the delay between polls. If zero, one minute is used.
+	Interval time.Duration
+
+	// ExpiryWarning, if positive, causes the watcher to notify of an
+	// EventExpiring once a secret that has not been retrieved will expire
+	// within ExpiryWarning.
+	ExpiryWarning time.Duration
+
+	// OnError, if not nil, is called by Run with errors polling or notifying.
+	// Run keeps polling regardless.
+	OnError func(error)
+
+	secrets map[string]*watchedSecret
+}
+
+type watchedSecret struct {
+	meta   PartialMetadata
+	warned bool
+	done   bool
+}
+
+// Run polls until ctx is done, then returns ctx.Err().
+func (w *Watcher) Run(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	for {
+		if err := w.Check(ctx); err != nil && ctx.Err() == nil && w.OnError != nil {
+			w.OnError(err)
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return err
+		}
+	}
+}
+
+// Check polls once and notifies of the changes since the last poll. It
+// returns the first error polling or notifying.
+func (w *Watcher) Check(ctx context.Context) error {
+	metas, err := w.poll(ctx)
+	if err != nil {
+		return err
+	}
+
+	first := w.secrets == nil
+	if first {
+		w.secrets = map[string]*watchedSecret{}
+	}
+
+	now := time.Now()
+	var events []Event
+	listed := map[string]bool{}
+	for _, m := range metas {
+		if !w.watches(m.MetadataKey) {
+			continue
+		}
+		listed[m.MetadataKey] = true
+
+		s, ok := w.secrets[m.MetadataKey]
+		if !ok {
+			s = &watchedSecret{meta: m}
+			if !first {
+				// the secret was created since the last poll
+				s.meta.State = SecretStateNew
+			}
+			w.secrets[m.MetadataKey] = s
+		}
+		events = append(events, w.update(s, m, now)...)
+	}
+
+	for key, s := range w.secrets {
+		if listed[key] {
+			continue
+		}
+		// the metadata has expired, so the secret has too
+		if !s.done {
+			events = append(events, Event{Type: EventExpired, Metadata: s.meta, Previous: s.meta.State, Time: now})
+		}
+		delete(w.secrets, key)
+	}
+
+	var firstErr error
+	for _, e := range events {
+		if err := w.Notifier.Notify(ctx, e); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// poll returns the metadata of the watched secrets whose metadata has not
+// expired.
+func (w *Watcher) poll(ctx context.Context) ([]PartialMetadata, error) {
+	if !w.PollMetadata {
+		return w.Client.GetRecentMetadataContext(ctx)
+	}
+
+	var metas []PartialMetadata
+	for _, key := range w.MetadataKeys {
+		m, err := w.Client.GetMetadataContext(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if m.State == SecretStateViewed {
+			// viewed by this poll or an earlier one
+			m.State = SecretStateNew
+		}
+		metas = append(metas, PartialMetadata{
+			CustomerID:         m.CustomerID,
+			MetadataKey:        m.MetadataKey,
+			InitialMetadataTTL: m.InitialMetadataTTL,
+			MetadataTTL:        m.MetadataTTL,
+			SecretTTL:          m.SecretTTL,
+			State:              m.State,
+			Updated:            m.Updated,
+			Created:            m.Created,
+			Recipient:          m.ObfuscatedRecipient,
+			ShareDomain:        m.ShareDomain,
+			asOf:               m.asOf,
+		})
+	}
+	return metas, nil
+}
+
+// update records a secret's latest metadata and returns the resulting events.
+func (w *Watcher) update(s *watchedSecret, m PartialMetadata, now time.Time) []Event {
+	prev := s.meta.State
+	s.meta = m
+	if s.done {
+		return nil
+	}
+
+	var events []Event
+	if m.State != prev {
+		switch m.State {
+		case SecretStateViewed:
+			events = append(events, Event{Type: EventViewed, Metadata: m, Previous: prev, Time: now})
+		case SecretStateReceived:
+			events = append(events, Event{Type: EventReceived, Metadata: m, Previous: prev, Time: now})
+		case SecretStateBurned:
+			events = append(events, Event{Type: EventBurned, Metadata: m, Previous: prev, Time: now})
+		}
+	}
+	if isDestroyed(m.State) {
+		s.done = true
+		return events
+	}
+
+	if m.SecretTTL <= 0 {
+		s.done = true
+		return append(events, Event{Type: EventExpired, Metadata: m, Previous: m.State, Time: now})
+	}
+	if w.ExpiryWarning > 0 && !s.warned && !m.SecretExpiresAt().After(now.Add(w.ExpiryWarning)) {
+		s.warned = true
+		events = append(events, Event{Type: EventExpiring, Metadata: m, Previous: m.State, Time: now})
+	}
+	return events
+}
+
+func (w *Watcher) watches(metadataKey string) bool {
+	if len(w.MetadataKeys) == 0 {
+		return true
+	}
+	for _, key := range w.MetadataKeys {
+		if key == metadataKey {
+			return true
+		}
+	}
+	return false
+}
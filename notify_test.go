@@ -0,0 +1,208 @@
+package onetimesecret
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/corbaltcode/go-onetimesecret/otstest"
+)
+
+// recordEvents returns a Notifier that appends events to *events.
+func recordEvents(events *[]Event) Notifier {
+	return NotifierFunc(func(ctx context.Context, e Event) error {
+		*events = append(*events, e)
+		return nil
+	})
+}
+
+func TestWatcherStateChanges(t *testing.T) {
+	c, _ := newTestClient(t)
+	var events []Event
+	w := &Watcher{Client: c, Notifier: recordEvents(&events)}
+
+	received, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := w.Check(context.Background()); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("got events %+v on first check (want none)", events)
+	}
+
+	burned, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if _, err := c.Get(received.SecretKey, ""); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if _, err := c.Burn(burned.MetadataKey, ""); err != nil {
+		t.Fatalf("burn failed: %v", err)
+	}
+	if err := w.Check(context.Background()); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+
+	got := map[string]EventType{}
+	for _, e := range events {
+		got[e.Metadata.MetadataKey] = e.Type
+	}
+	if len(events) != 2 || got[received.MetadataKey] != EventReceived || got[burned.MetadataKey] != EventBurned {
+		t.Errorf("got events %+v (want one received and one burned)", events)
+	}
+
+	events = nil
+	if err := w.Check(context.Background()); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("got events %+v on unchanged check (want none)", events)
+	}
+}
+
+func TestWatcherExpiry(t *testing.T) {
+	c, srv := newTestClient(t)
+	var events []Event
+	w := &Watcher{Client: c, Notifier: recordEvents(&events), ExpiryWarning: 5 * time.Minute}
+
+	meta, err := c.Put(randStr(), "", 10*60, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := w.Check(context.Background()); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("got events %+v (want none)", events)
+	}
+
+	srv.Advance(6 * time.Minute)
+	if err := w.Check(context.Background()); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventExpiring || events[0].Metadata.MetadataKey != meta.MetadataKey {
+		t.Errorf("got events %+v (want expiring)", events)
+	}
+
+	events = nil
+	srv.Advance(5 * time.Minute)
+	if err := w.Check(context.Background()); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventExpired {
+		t.Errorf("got events %+v (want expired)", events)
+	}
+}
+
+func TestWatcherMetadataKeys(t *testing.T) {
+	c, _ := newTestClient(t)
+	var events []Event
+	w := &Watcher{Client: c, Notifier: recordEvents(&events)}
+
+	watched, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	ignored, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	w.MetadataKeys = []string{watched.MetadataKey}
+	if err := w.Check(context.Background()); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+
+	for _, m := range []Metadata{watched, ignored} {
+		if _, err := c.Burn(m.MetadataKey, ""); err != nil {
+			t.Fatalf("burn failed: %v", err)
+		}
+	}
+	if err := w.Check(context.Background()); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Metadata.MetadataKey != watched.MetadataKey {
+		t.Errorf("got events %+v (want one for %v)", events, watched.MetadataKey)
+	}
+}
+
+func TestWatcherPollMetadata(t *testing.T) {
+	c, srv := newTestClientServer(t, []otstest.Option{otstest.WithUser("user@example.com", "my-key")})
+	c.Anonymous = true
+	received, err := c.Put(randStr(), "", 10*60, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	expired, err := c.Put(randStr(), "", 10*60, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	var events []Event
+	w := &Watcher{
+		Client:       c,
+		Notifier:     recordEvents(&events),
+		MetadataKeys: []string{received.MetadataKey, expired.MetadataKey},
+		PollMetadata: true,
+	}
+	for i := 0; i < 2; i++ {
+		if err := w.Check(context.Background()); err != nil {
+			t.Fatalf("check failed: %v", err)
+		}
+	}
+	if len(events) != 0 {
+		t.Errorf("got events %+v (want none)", events)
+	}
+
+	if _, err := c.Get(received.SecretKey, ""); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if err := w.Check(context.Background()); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventReceived || events[0].Metadata.MetadataKey != received.MetadataKey {
+		t.Errorf("got events %+v (want received)", events)
+	}
+
+	events = nil
+	srv.Advance(11 * time.Minute)
+	if err := w.Check(context.Background()); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != EventExpired || events[0].Metadata.MetadataKey != expired.MetadataKey {
+		t.Errorf("got events %+v (want expired)", events)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got Event
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode failed: %v", err)
+		}
+	}))
+	defer hook.Close()
+
+	n := &WebhookNotifier{URL: hook.URL}
+	e := Event{Type: EventReceived, Metadata: PartialMetadata{MetadataKey: "abc123", State: SecretStateReceived}}
+	if err := n.Notify(context.Background(), e); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if got.Type != e.Type || got.Metadata.MetadataKey != e.Metadata.MetadataKey {
+		t.Errorf("got event %+v (want %+v)", got, e)
+	}
+
+	n.URL = hook.URL + "/missing"
+	if err := n.Notify(context.Background(), e); err == nil {
+		t.Errorf("notify succeeded despite 404")
+	}
+}
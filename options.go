@@ -0,0 +1,72 @@
+package onetimesecret
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// An Option configures a Client created by NewClient.
+type Option func(*Client)
+
+// NewClient returns a Client that authenticates with the given username and
+// API key, configured by opts. A Client created with a struct literal, such
+// as Client{Username: username, Key: key}, is equivalent to one created by
+// NewClient without options.
+func NewClient(username string, key string, opts ...Option) *Client {
+	c := &Client{
+		Username: username,
+		Key:      key,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewAnonymousClient returns a Client that sends requests without
+// credentials, configured by opts.
+func NewAnonymousClient(opts ...Option) *Client {
+	c := &Client{Anonymous: true}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithHTTPClient sets the HTTP client used to send requests. Use it to
+// configure proxies, TLS roots, client certificates, or connection pooling.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.HTTPClient = hc
+	}
+}
+
+// WithTransport sets the RoundTripper used to send requests, leaving other
+// HTTP client settings at their defaults.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.HTTPClient = &http.Client{Transport: rt}
+	}
+}
+
+// WithBaseURL sets the root URL of the One-Time Secret server.
+func WithBaseURL(u *url.URL) Option {
+	return func(c *Client) {
+		c.BaseURL = u
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.UserAgent = userAgent
+	}
+}
+
+// WithTimeout limits the time each request may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.Timeout = timeout
+	}
+}
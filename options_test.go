@@ -0,0 +1,54 @@
+package onetimesecret
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewClientOptions(t *testing.T) {
+	base, err := url.Parse("https://ots.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotReq *http.Request
+	rt := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		gotReq = req
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"status":"nominal"}`)),
+			Header:     make(http.Header),
+			Request:    req,
+		}, nil
+	})
+
+	c := NewClient("user", "key", WithTransport(rt), WithBaseURL(base), WithUserAgent("test-agent/1.0"))
+	status, err := c.GetSystemStatus()
+	if err != nil {
+		t.Fatalf("GetSystemStatus failed: %v", err)
+	}
+	if status != SystemStatusNominal {
+		t.Errorf("got status %v (want %v)", status, SystemStatusNominal)
+	}
+	if gotReq == nil {
+		t.Fatal("transport was not used")
+	}
+	if got, want := gotReq.URL.String(), "https://ots.example.com/api/v1/status"; got != want {
+		t.Errorf("got URL %v (want %v)", got, want)
+	}
+	if got, want := gotReq.Header.Get("User-Agent"), "test-agent/1.0"; got != want {
+		t.Errorf("got User-Agent %v (want %v)", got, want)
+	}
+	if username, key, ok := gotReq.BasicAuth(); !ok || username != "user" || key != "key" {
+		t.Errorf("got basic auth %v, %v, %v (want user, key, true)", username, key, ok)
+	}
+}
@@ -0,0 +1,644 @@
+// Package otstest provides an in-memory One-Time Secret server for testing
+// code that uses the onetimesecret package without network access or
+// credentials.
+//
+// A Server implements the v1 API endpoints share, generate, secret/{key},
+// private/{key}, private/{key}/burn, private/recent, and status, and the
+// corresponding v2 endpoints, which exchange JSON documents. Secrets move
+// through the same states as on onetimesecret.com and expire according to a
+// clock that tests can advance. Faults can be injected to exercise error
+// handling.
+package otstest
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is the secret TTL used when a request does not specify one.
+const DefaultTTL = 7 * 24 * time.Hour
+
+const (
+	keyLength       = 31
+	generatedLength = 12
+	keyAlphabet     = "abcdefghijklmnopqrstuvwxyz0123456789"
+	secretAlphabet  = "abcdefghjkmnpqrstuvwxyzABCDEFGHJKMNPQRSTUVWXYZ23456789!$%*"
+	anonCustomerID  = "anon"
+)
+
+// A Fault describes an error response the server returns instead of handling
+// a request.
+type Fault struct {
+	// Path is the API path the fault applies to, such as "share" or
+	// "private/recent". Paths ending in "*" match any path with the given
+	// prefix. An empty Path matches every request.
+	Path string
+
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Message is sent as the JSON error message. If Body is not empty, it is
+	// sent instead.
+	Message string
+	Body    string
+
+	// RetryAfter, if not empty, is sent in the Retry-After header.
+	RetryAfter string
+
+	// Delay is how long the server waits before responding.
+	Delay time.Duration
+
+	// Times is the number of requests the fault applies to. If zero, the
+	// fault applies until ClearFaults is called.
+	Times int
+}
+
+type record struct {
+	customerID     string
+	metadataKey    string
+	secretKey      string
+	value          string
+	passphrase     string
+	recipient      string
+	shareDomain    string
+	ttl            time.Duration
+	state          string
+	created        time.Time
+	updated        time.Time
+	secretExpiry   time.Time
+	metadataExpiry time.Time
+}
+
+// A Server is a fake One-Time Secret server. Create one with NewServer and
+// point a Client at its URL.
+type Server struct {
+	// URL is the base URL of the server, suitable for Client.BaseURL.
+	URL string
+
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	clock    func() time.Time
+	offset   time.Duration
+	users    map[string]string
+	maxSize  int
+	status   string
+	records  map[string]*record // by metadata key
+	secrets  map[string]*record // by secret key
+	faults   []*Fault
+	requests map[string]int
+}
+
+// An Option configures a Server created by NewServer.
+type Option func(*Server)
+
+// WithClock sets the function the server uses to get the current time. By
+// default, the server uses time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.clock = now
+	}
+}
+
+// WithUser adds an account. If a server has accounts, requests with
+// credentials that match none of them are rejected with 401 Unauthorized. If
+// it has none, any credentials are accepted.
+func WithUser(username string, key string) Option {
+	return func(s *Server) {
+		s.users[username] = key
+	}
+}
+
+// WithMaxSecretSize limits the size in bytes of stored secrets. Larger
+// secrets are rejected with 413 Request Entity Too Large. By default, there is
+// no limit.
+func WithMaxSecretSize(n int) Option {
+	return func(s *Server) {
+		s.maxSize = n
+	}
+}
+
+// NewServer starts and returns a new Server. The caller should call Close
+// when finished.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		clock:    time.Now,
+		users:    map[string]string{},
+		status:   "nominal",
+		records:  map[string]*record{},
+		secrets:  map[string]*record{},
+		requests: map[string]int{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Advance moves the server's clock forward by d, expiring secrets and
+// metadata whose TTL has elapsed.
+func (s *Server) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+}
+
+// SetStatus sets the system status reported by the status endpoint, such as
+// "nominal" or "offline".
+func (s *Server) SetStatus(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// InjectFault adds a fault. Faults are checked in the order they were added.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns the number of requests received for the given API path,
+// including requests that failed.
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Secret returns the stored value of the secret with the given secret key
+// without destroying it. It reports false if there is no such secret.
+func (s *Server) Secret(secretKey string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.secrets[secretKey]
+	if !ok || !s.now().Before(r.secretExpiry) {
+		return "", false
+	}
+	return r.value, true
+}
+
+func (s *Server) now() time.Time {
+	return s.clock().Add(s.offset)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var version, path string
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/v1/"):
+		version, path = "v1", strings.TrimPrefix(r.URL.Path, "/api/v1/")
+	case strings.HasPrefix(r.URL.Path, "/api/v2/"):
+		version, path = "v2", strings.TrimPrefix(r.URL.Path, "/api/v2/")
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	s.mu.Lock()
+	s.requests[path]++
+	f := s.matchFault(path)
+	s.mu.Unlock()
+
+	if f != nil {
+		if f.Delay > 0 {
+			select {
+			case <-time.After(f.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if f.RetryAfter != "" {
+			w.Header().Set("Retry-After", f.RetryAfter)
+		}
+		if f.Body != "" {
+			w.WriteHeader(f.StatusCode)
+			w.Write([]byte(f.Body))
+		} else {
+			writeError(w, f.StatusCode, f.Message)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	customerID, ok := s.authenticate(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Not authorized")
+		return
+	}
+
+	if version == "v2" {
+		s.serveV2(w, r, path, customerID)
+	} else {
+		s.serveV1(w, r, path, customerID)
+	}
+}
+
+func (s *Server) serveV1(w http.ResponseWriter, r *http.Request, path string, customerID string) {
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "status" && r.Method == http.MethodGet:
+		writeJSON(w, map[string]string{"status": s.status})
+	case path == "share" && r.Method == http.MethodPost:
+		s.handleShare(w, r, customerID)
+	case path == "generate" && r.Method == http.MethodPost:
+		s.handleGenerate(w, r, customerID)
+	case path == "private/recent" && r.Method == http.MethodGet:
+		s.handleRecent(w, customerID)
+	case len(parts) == 2 && parts[0] == "secret" && r.Method == http.MethodPost:
+		s.handleGet(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "private" && r.Method == http.MethodPost:
+		s.handleMetadata(w, parts[1])
+	case len(parts) == 3 && parts[0] == "private" && parts[2] == "burn" && r.Method == http.MethodPost:
+		s.handleBurn(w, r, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// matchFault returns the first fault that applies to path, consuming one of
+// its uses. s.mu must be held.
+func (s *Server) matchFault(path string) *Fault {
+	for i, f := range s.faults {
+		if !faultMatches(f.Path, path) {
+			continue
+		}
+		matched := *f
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return &matched
+	}
+	return nil
+}
+
+func faultMatches(pattern string, path string) bool {
+	if pattern == "" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(path, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == path
+}
+
+// authenticate returns the customer ID for the request's credentials. It
+// reports false if the credentials are not valid.
+func (s *Server) authenticate(r *http.Request) (string, bool) {
+	username, key, ok := r.BasicAuth()
+	if !ok || username == "" {
+		return anonCustomerID, true
+	}
+	if len(s.users) == 0 {
+		return username, true
+	}
+	if want, ok := s.users[username]; ok && want == key {
+		return username, true
+	}
+	return "", false
+}
+
+// createParams holds the parameters of a request to store or generate a
+// secret.
+type createParams struct {
+	passphrase  string
+	ttl         string
+	recipient   string
+	shareDomain string
+}
+
+func formCreateParams(r *http.Request) createParams {
+	return createParams{
+		passphrase: r.FormValue("passphrase"),
+		ttl:        r.FormValue("ttl"),
+		recipient:  r.FormValue("recipient"),
+	}
+}
+
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request, customerID string) {
+	value := r.FormValue("secret")
+	if value == "" {
+		writeError(w, http.StatusNotFound, "You did not provide anything to share")
+		return
+	}
+	if s.tooLarge(value) {
+		writeError(w, http.StatusRequestEntityTooLarge, "Secret is too large")
+		return
+	}
+	rec, msg := s.create(customerID, value, formCreateParams(r))
+	if rec == nil {
+		writeError(w, http.StatusNotFound, msg)
+		return
+	}
+	writeJSON(w, s.keyResponse(rec, true))
+}
+
+func (s *Server) tooLarge(value string) bool {
+	return s.maxSize > 0 && len(value) > s.maxSize
+}
+
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request, customerID string) {
+	value := randString(secretAlphabet, generatedLength)
+	rec, msg := s.create(customerID, value, formCreateParams(r))
+	if rec == nil {
+		writeError(w, http.StatusNotFound, msg)
+		return
+	}
+	kr := s.keyResponse(rec, true)
+	kr.Value = value
+	writeJSON(w, kr)
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, secretKey string) {
+	value, ok := s.reveal(secretKey, r.FormValue("passphrase"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown secret")
+		return
+	}
+	writeJSON(w, keyResponse{
+		SecretKey: secretKey,
+		Value:     value,
+	})
+}
+
+func (s *Server) handleMetadata(w http.ResponseWriter, metadataKey string) {
+	rec, ok := s.viewMetadata(metadataKey)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown secret")
+		return
+	}
+	writeJSON(w, s.keyResponse(rec, true))
+}
+
+func (s *Server) handleBurn(w http.ResponseWriter, r *http.Request, metadataKey string) {
+	secretKey := ""
+	if rec, ok := s.lookupMetadata(metadataKey); ok {
+		secretKey = rec.secretKey
+	}
+	rec, ok := s.burn(metadataKey, r.FormValue("passphrase"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown secret")
+		return
+	}
+	if len(secretKey) > 8 {
+		secretKey = secretKey[:8]
+	}
+	writeJSON(w, burnResponse{
+		State:          s.keyResponse(rec, true),
+		SecretShortkey: secretKey,
+	})
+}
+
+func (s *Server) handleRecent(w http.ResponseWriter, customerID string) {
+	if customerID == anonCustomerID {
+		writeError(w, http.StatusUnauthorized, "Not authorized")
+		return
+	}
+	krs := []keyResponse{}
+	for _, rec := range s.recent(customerID) {
+		krs = append(krs, s.keyResponse(rec, false))
+	}
+	writeJSON(w, krs)
+}
+
+// create stores a secret. If the parameters are invalid, it returns nil and
+// an error message. s.mu must be held.
+func (s *Server) create(customerID string, value string, p createParams) (*record, string) {
+	ttl := DefaultTTL
+	if p.ttl != "" {
+		secs, err := strconv.Atoi(p.ttl)
+		if err != nil || secs < 0 {
+			return nil, "Invalid TTL"
+		}
+		if secs > 0 {
+			ttl = time.Duration(secs) * time.Second
+		}
+	}
+
+	now := s.now()
+	rec := &record{
+		customerID:     customerID,
+		metadataKey:    s.newKey(),
+		secretKey:      s.newKey(),
+		value:          value,
+		passphrase:     p.passphrase,
+		recipient:      p.recipient,
+		shareDomain:    p.shareDomain,
+		ttl:            ttl,
+		state:          "new",
+		created:        now,
+		updated:        now,
+		secretExpiry:   now.Add(ttl),
+		metadataExpiry: now.Add(2 * ttl),
+	}
+	s.records[rec.metadataKey] = rec
+	s.secrets[rec.secretKey] = rec
+	return rec, ""
+}
+
+// reveal returns and destroys a secret. s.mu must be held.
+func (s *Server) reveal(secretKey string, passphrase string) (string, bool) {
+	rec, ok := s.secrets[secretKey]
+	if !ok || !s.now().Before(rec.secretExpiry) || passphrase != rec.passphrase {
+		return "", false
+	}
+	value := rec.value
+	s.destroySecret(rec, "received")
+	return value, true
+}
+
+// viewMetadata returns a secret's metadata, marking a new secret viewed. s.mu
+// must be held.
+func (s *Server) viewMetadata(metadataKey string) (*record, bool) {
+	rec, ok := s.lookupMetadata(metadataKey)
+	if !ok {
+		return nil, false
+	}
+	if rec.state == "new" {
+		rec.state = "viewed"
+		rec.updated = s.now()
+	}
+	return rec, true
+}
+
+// burn destroys a secret given its metadata key. s.mu must be held.
+func (s *Server) burn(metadataKey string, passphrase string) (*record, bool) {
+	rec, ok := s.lookupMetadata(metadataKey)
+	if !ok || !s.secretExists(rec) || passphrase != rec.passphrase {
+		return nil, false
+	}
+	s.destroySecret(rec, "burned")
+	return rec, true
+}
+
+// recent returns the unexpired records of a customer. s.mu must be held.
+func (s *Server) recent(customerID string) []*record {
+	var recs []*record
+	for _, rec := range s.records {
+		if rec.customerID == customerID && s.now().Before(rec.metadataExpiry) {
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+func (s *Server) lookupMetadata(metadataKey string) (*record, bool) {
+	rec, ok := s.records[metadataKey]
+	if !ok || !s.now().Before(rec.metadataExpiry) {
+		return nil, false
+	}
+	return rec, true
+}
+
+func (s *Server) secretExists(rec *record) bool {
+	_, ok := s.secrets[rec.secretKey]
+	return ok && s.now().Before(rec.secretExpiry)
+}
+
+// destroySecret removes a secret's value, leaving its metadata in the given
+// state.
+func (s *Server) destroySecret(rec *record, state string) {
+	delete(s.secrets, rec.secretKey)
+	rec.value = ""
+	rec.state = state
+	rec.updated = s.now()
+}
+
+func (s *Server) keyResponse(rec *record, includeSecretKey bool) keyResponse {
+	now := s.now()
+	kr := keyResponse{
+		CustomerID:         rec.customerID,
+		MetadataKey:        rec.metadataKey,
+		TTL:                int(rec.ttl / time.Second),
+		MetadataTTL:        remainingSeconds(rec.metadataExpiry, now),
+		SecretTTL:          remainingSeconds(rec.secretExpiry, now),
+		State:              rec.state,
+		Updated:            int(rec.updated.Unix()),
+		Created:            int(rec.created.Unix()),
+		Recipient:          []string{},
+		PassphraseRequired: rec.passphrase != "",
+	}
+	if includeSecretKey && s.secretExists(rec) {
+		kr.SecretKey = rec.secretKey
+	}
+	if rec.recipient != "" {
+		kr.Recipient = []string{ObfuscateEmail(rec.recipient)}
+	}
+	return kr
+}
+
+// newKey returns a random key that is not in use. s.mu must be held.
+func (s *Server) newKey() string {
+	for {
+		k := randString(keyAlphabet, keyLength)
+		_, isMetadataKey := s.records[k]
+		_, isSecretKey := s.secrets[k]
+		if !isMetadataKey && !isSecretKey {
+			return k
+		}
+	}
+}
+
+// ObfuscateEmail obfuscates an email address the way One-Time Secret does
+// when reporting a secret's recipient, for example turning "foo@example.com"
+// into "fo*****@e*****.com".
+func ObfuscateEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return obfuscate(email, 2)
+	}
+	local, domain := email[:at], email[at+1:]
+	tld := ""
+	if dot := strings.LastIndex(domain, "."); dot >= 0 {
+		domain, tld = domain[:dot], domain[dot:]
+	}
+	return obfuscate(local, 2) + "@" + obfuscate(domain, 1) + tld
+}
+
+func obfuscate(s string, keep int) string {
+	if len(s) < keep {
+		keep = len(s)
+	}
+	return s[:keep] + "*****"
+}
+
+func remainingSeconds(t time.Time, now time.Time) int {
+	d := t.Sub(now)
+	if d < 0 {
+		return 0
+	}
+	return int(d / time.Second)
+}
+
+func randString(alphabet string, n int) string {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range b {
+		j, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = alphabet[j.Int64()]
+	}
+	return string(b)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Message: message})
+}
+
+type burnResponse struct {
+	State          keyResponse `json:"state"`
+	SecretShortkey string      `json:"secret_shortkey"`
+}
+
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+type keyResponse struct {
+	CustomerID         string   `json:"custid,omitempty"`
+	MetadataKey        string   `json:"metadata_key,omitempty"`
+	SecretKey          string   `json:"secret_key,omitempty"`
+	TTL                int      `json:"ttl,omitempty"`
+	MetadataTTL        int      `json:"metadata_ttl,omitempty"`
+	SecretTTL          int      `json:"secret_ttl,omitempty"`
+	State              string   `json:"state,omitempty"`
+	Updated            int      `json:"updated,omitempty"`
+	Created            int      `json:"created,omitempty"`
+	Recipient          []string `json:"recipient,omitempty"`
+	Value              string   `json:"value,omitempty"`
+	PassphraseRequired bool     `json:"passphrase_required,omitempty"`
+}
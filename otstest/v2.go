@@ -0,0 +1,236 @@
+package otstest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (s *Server) serveV2(w http.ResponseWriter, r *http.Request, path string, customerID string) {
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "status" && r.Method == http.MethodGet:
+		writeJSON(w, v2StatusResponse{Status: s.status, Locale: "en"})
+	case path == "secret/conceal" && r.Method == http.MethodPost:
+		s.handleConcealV2(w, r, customerID)
+	case path == "secret/generate" && r.Method == http.MethodPost:
+		s.handleGenerateV2(w, r, customerID)
+	case path == "private/recent" && r.Method == http.MethodGet:
+		s.handleRecentV2(w, customerID)
+	case len(parts) == 3 && parts[0] == "secret" && parts[2] == "reveal" && r.Method == http.MethodPost:
+		s.handleRevealV2(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "private" && r.Method == http.MethodGet:
+		s.handleMetadataV2(w, parts[1])
+	case len(parts) == 3 && parts[0] == "private" && parts[2] == "burn" && r.Method == http.MethodPost:
+		s.handleBurnV2(w, r, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *Server) handleConcealV2(w http.ResponseWriter, r *http.Request, customerID string) {
+	var req v2CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if req.Secret.Secret == "" {
+		writeError(w, http.StatusBadRequest, "You did not provide anything to share")
+		return
+	}
+	if s.tooLarge(req.Secret.Secret) {
+		writeError(w, http.StatusRequestEntityTooLarge, "Secret is too large")
+		return
+	}
+	s.createV2(w, customerID, req.Secret.Secret, req, false)
+}
+
+func (s *Server) handleGenerateV2(w http.ResponseWriter, r *http.Request, customerID string) {
+	var req v2CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	s.createV2(w, customerID, randString(secretAlphabet, generatedLength), req, true)
+}
+
+func (s *Server) createV2(w http.ResponseWriter, customerID string, value string, req v2CreateRequest, includeValue bool) {
+	p := createParams{
+		passphrase:  req.Secret.Passphrase,
+		recipient:   req.Secret.Recipient,
+		shareDomain: req.Secret.ShareDomain,
+	}
+	if req.Secret.TTL != 0 {
+		p.ttl = strconv.Itoa(req.Secret.TTL)
+	}
+	rec, msg := s.create(customerID, value, p)
+	if rec == nil {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	resp := v2CreateResponse{Success: true}
+	resp.Record.Metadata = s.v2Metadata(rec, true)
+	resp.Record.Secret = v2SecretRecord{
+		Key:           rec.secretKey,
+		State:         rec.state,
+		Lifespan:      int(rec.ttl / time.Second),
+		SecretTTL:     remainingSeconds(rec.secretExpiry, s.now()),
+		HasPassphrase: rec.passphrase != "",
+	}
+	if includeValue {
+		resp.Record.Secret.SecretValue = value
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleRevealV2(w http.ResponseWriter, r *http.Request, secretKey string) {
+	var req v2PassphraseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	value, ok := s.reveal(secretKey, req.Passphrase)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown secret")
+		return
+	}
+	writeJSON(w, v2SecretResponse{
+		Success: true,
+		Record: v2SecretRecord{
+			Key:         secretKey,
+			State:       "received",
+			SecretValue: value,
+		},
+	})
+}
+
+func (s *Server) handleMetadataV2(w http.ResponseWriter, metadataKey string) {
+	rec, ok := s.viewMetadata(metadataKey)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown secret")
+		return
+	}
+	writeJSON(w, v2MetadataResponse{Success: true, Record: s.v2Metadata(rec, true)})
+}
+
+func (s *Server) handleBurnV2(w http.ResponseWriter, r *http.Request, metadataKey string) {
+	var req v2PassphraseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	rec, ok := s.burn(metadataKey, req.Passphrase)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown secret")
+		return
+	}
+	writeJSON(w, v2MetadataResponse{Success: true, Record: s.v2Metadata(rec, true)})
+}
+
+func (s *Server) handleRecentV2(w http.ResponseWriter, customerID string) {
+	if customerID == anonCustomerID {
+		writeError(w, http.StatusUnauthorized, "Not authorized")
+		return
+	}
+	resp := v2RecentResponse{Success: true, Records: []v2MetadataRecord{}}
+	for _, rec := range s.recent(customerID) {
+		resp.Records = append(resp.Records, s.v2Metadata(rec, false))
+	}
+	resp.Count = len(resp.Records)
+	writeJSON(w, resp)
+}
+
+func (s *Server) v2Metadata(rec *record, includeSecretKey bool) v2MetadataRecord {
+	now := s.now()
+	m := v2MetadataRecord{
+		Key:           rec.metadataKey,
+		CustomerID:    rec.customerID,
+		State:         rec.state,
+		Created:       int(rec.created.Unix()),
+		Updated:       int(rec.updated.Unix()),
+		Lifespan:      int(rec.ttl / time.Second),
+		MetadataTTL:   remainingSeconds(rec.metadataExpiry, now),
+		SecretTTL:     remainingSeconds(rec.secretExpiry, now),
+		Recipients:    []string{},
+		ShareDomain:   rec.shareDomain,
+		HasPassphrase: rec.passphrase != "",
+	}
+	if includeSecretKey && s.secretExists(rec) {
+		m.SecretKey = rec.secretKey
+	}
+	if rec.recipient != "" {
+		m.Recipients = []string{ObfuscateEmail(rec.recipient)}
+	}
+	return m
+}
+
+type v2CreateRequest struct {
+	Secret struct {
+		Secret      string `json:"secret"`
+		Passphrase  string `json:"passphrase"`
+		TTL         int    `json:"ttl"`
+		Recipient   string `json:"recipient"`
+		ShareDomain string `json:"share_domain"`
+	} `json:"secret"`
+}
+
+type v2PassphraseRequest struct {
+	Passphrase string `json:"passphrase"`
+	Continue   bool   `json:"continue"`
+}
+
+type v2CreateResponse struct {
+	Success bool `json:"success"`
+	Record  struct {
+		Metadata v2MetadataRecord `json:"metadata"`
+		Secret   v2SecretRecord   `json:"secret"`
+	} `json:"record"`
+}
+
+type v2MetadataResponse struct {
+	Success bool             `json:"success"`
+	Record  v2MetadataRecord `json:"record"`
+}
+
+type v2SecretResponse struct {
+	Success bool           `json:"success"`
+	Record  v2SecretRecord `json:"record"`
+}
+
+type v2RecentResponse struct {
+	Success bool               `json:"success"`
+	Records []v2MetadataRecord `json:"records"`
+	Count   int                `json:"count"`
+}
+
+type v2StatusResponse struct {
+	Status string `json:"status"`
+	Locale string `json:"locale"`
+}
+
+type v2MetadataRecord struct {
+	Key           string   `json:"key"`
+	CustomerID    string   `json:"custid"`
+	SecretKey     string   `json:"secret_key,omitempty"`
+	State         string   `json:"state"`
+	Created       int      `json:"created"`
+	Updated       int      `json:"updated"`
+	Lifespan      int      `json:"lifespan"`
+	MetadataTTL   int      `json:"metadata_ttl"`
+	SecretTTL     int      `json:"secret_ttl"`
+	Recipients    []string `json:"recipients"`
+	ShareDomain   string   `json:"share_domain"`
+	HasPassphrase bool     `json:"has_passphrase"`
+}
+
+type v2SecretRecord struct {
+	Key           string `json:"key"`
+	State         string `json:"state"`
+	Lifespan      int    `json:"lifespan,omitempty"`
+	SecretTTL     int    `json:"secret_ttl,omitempty"`
+	HasPassphrase bool   `json:"has_passphrase"`
+	SecretValue   string `json:"secret_value,omitempty"`
+}
@@ -0,0 +1,131 @@
+package onetimesecret
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+)
+
+const (
+	defaultMinBackoff = 250 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+)
+
+// A RetryPolicy controls how a Client retries requests that fail transiently,
+// for example because the server is rate limiting the client, is temporarily
+// unavailable, or the connection is reset.
+//
+// Requests that read metadata or system status are retried after any
+// transient failure. Requests that change state, such as Get, which reveals
+// and destroys a secret, are retried only if the server cannot have processed
+// them: when it responds with 429 Too Many Requests or the connection could
+// not be established.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first. A
+	// value less than 2 disables retries.
+	MaxAttempts int
+
+	// MinBackoff is the delay before the first retry. Each later delay is
+	// doubled, up to MaxBackoff, and randomized by up to half to spread out
+	// retries from many clients. If zero, 250ms is used.
+	MinBackoff time.Duration
+
+	// MaxBackoff limits the delay between attempts, except that a longer
+	// delay requested by the server with a Retry-After header is honored. If
+	// zero, 10s is used.
+	MaxBackoff time.Duration
+}
+
+// WithRetry sets the policy for retrying requests that fail transiently.
+func WithRetry(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.Retry = &p
+	}
+}
+
+// next reports whether a request that failed with err on the given attempt
+// should be retried and, if so, how long to wait first.
+func (p *RetryPolicy) next(attempt int, err error, idempotent bool) (time.Duration, bool) {
+	if p == nil || attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if !isRetryable(err, idempotent) {
+		return 0, false
+	}
+
+	delay := p.backoff(attempt)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > delay {
+		delay = apiErr.RetryAfter
+	}
+
+	return delay, true
+}
+
+// backoff returns the randomized delay after the given attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	min := p.MinBackoff
+	if min <= 0 {
+		min = defaultMinBackoff
+	}
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+
+	d := min
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func isRetryable(err error, idempotent bool) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+
+	var opErr *net.OpError
+	isOpErr := errors.As(err, &opErr)
+	if isOpErr && opErr.Op == "dial" {
+		return true
+	}
+
+	if !idempotent {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+
+	// The connection failed while sending the request or reading the
+	// response, for example because it was reset.
+	return isOpErr || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,100 @@
+package onetimesecret
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/corbaltcode/go-onetimesecret/otstest"
+)
+
+func newRetryingTestClient(t *testing.T) (*Client, *otstest.Server) {
+	return newTestClient(t, WithRetry(RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	}))
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	c, srv := newRetryingTestClient(t)
+	srv.InjectFault(otstest.Fault{Path: "status", StatusCode: http.StatusServiceUnavailable, Times: 2})
+	status, err := c.GetSystemStatus()
+	if err != nil {
+		t.Fatalf("GetSystemStatus failed: %v", err)
+	}
+	if status != SystemStatusNominal {
+		t.Errorf("got status %v (want %v)", status, SystemStatusNominal)
+	}
+	if n := srv.Requests("status"); n != 3 {
+		t.Errorf("got %v attempts (want 3)", n)
+	}
+}
+
+func TestRetryGiveUp(t *testing.T) {
+	c, srv := newRetryingTestClient(t)
+	srv.InjectFault(otstest.Fault{Path: "status", StatusCode: http.StatusBadGateway})
+	_, err := c.GetSystemStatus()
+	if !errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("got error %v (want %v)", err, ErrServiceUnavailable)
+	}
+	if n := srv.Requests("status"); n != 3 {
+		t.Errorf("got %v attempts (want 3)", n)
+	}
+}
+
+func TestRetryGetNotRetriedAfterServerError(t *testing.T) {
+	c, srv := newRetryingTestClient(t)
+	meta, err := c.Put("s3cret", "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	path := "secret/" + meta.SecretKey
+	srv.InjectFault(otstest.Fault{Path: path, StatusCode: http.StatusServiceUnavailable, Times: 1})
+	_, err = c.Get(meta.SecretKey, "")
+	if !errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("got error %v (want %v)", err, ErrServiceUnavailable)
+	}
+	if n := srv.Requests(path); n != 1 {
+		t.Errorf("got %v attempts (want 1)", n)
+	}
+}
+
+func TestRetryGetRateLimited(t *testing.T) {
+	c, srv := newRetryingTestClient(t)
+	meta, err := c.Put("s3cret", "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	path := "secret/" + meta.SecretKey
+	srv.InjectFault(otstest.Fault{Path: path, StatusCode: http.StatusTooManyRequests, RetryAfter: "1", Times: 1})
+
+	start := time.Now()
+	secret, err := c.Get(meta.SecretKey, "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if secret != "s3cret" {
+		t.Errorf("got secret %v (want %v)", secret, "s3cret")
+	}
+	if n := srv.Requests(path); n != 2 {
+		t.Errorf("got %v attempts (want 2)", n)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v (want at least Retry-After of 1s)", elapsed)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, want := range []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if attempt == 0 {
+			continue
+		}
+		got := p.backoff(attempt)
+		if got < want/2 || got > want {
+			t.Errorf("attempt %v: got backoff %v (want between %v and %v)", attempt, got, want/2, want)
+		}
+	}
+}
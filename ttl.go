@@ -0,0 +1,95 @@
+package onetimesecret
+
+import "time"
+
+// WithDefaultTTL sets the TTL of secrets the client stores or generates when
+// a call does not specify one.
+func WithDefaultTTL(d time.Duration) Option {
+	return func(c *Client) {
+		c.DefaultTTL = d
+	}
+}
+
+// ttlSeconds returns the TTL in seconds to request for a new secret.
+func (c *Client) ttlSeconds(ttl time.Duration) int {
+	if ttl == 0 {
+		ttl = c.DefaultTTL
+	}
+	return TTLSeconds(ttl)
+}
+
+// TTLSeconds converts a duration to the whole number of seconds taken by the
+// secretTTL parameters of Put and Generate, rounding up. Negative durations
+// are treated as zero.
+func TTLSeconds(d time.Duration) int {
+	if d < 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// SecretExpiresAt returns the time at which the secret expires, computed from
+// SecretTTL as of when the metadata was retrieved. If the secret has been
+// destroyed, SecretExpiresAt returns the zero time.
+func (m Metadata) SecretExpiresAt() time.Time {
+	if isDestroyed(m.State) {
+		return time.Time{}
+	}
+	return expiresAt(m.asOf, m.Updated, m.SecretTTL)
+}
+
+// MetadataExpiresAt returns the time at which the metadata expires, computed
+// from MetadataTTL as of when the metadata was retrieved.
+func (m Metadata) MetadataExpiresAt() time.Time {
+	return expiresAt(m.asOf, m.Updated, m.MetadataTTL)
+}
+
+// IsExpired reports whether the secret has expired by now. It reports false
+// for secrets that were destroyed before expiring.
+func (m Metadata) IsExpired(now time.Time) bool {
+	return isExpired(m.SecretExpiresAt(), now)
+}
+
+// SecretExpiresAt returns the time at which the secret expires, computed from
+// SecretTTL as of when the metadata was retrieved. If the secret has been
+// destroyed, SecretExpiresAt returns the zero time.
+func (m PartialMetadata) SecretExpiresAt() time.Time {
+	if isDestroyed(m.State) {
+		return time.Time{}
+	}
+	return expiresAt(m.asOf, m.Updated, m.SecretTTL)
+}
+
+// MetadataExpiresAt returns the time at which the metadata expires, computed
+// from MetadataTTL as of when the metadata was retrieved.
+func (m PartialMetadata) MetadataExpiresAt() time.Time {
+	return expiresAt(m.asOf, m.Updated, m.MetadataTTL)
+}
+
+// IsExpired reports whether the secret has expired by now. It reports false
+// for secrets that were destroyed before expiring.
+func (m PartialMetadata) IsExpired(now time.Time) bool {
+	return isExpired(m.SecretExpiresAt(), now)
+}
+
+// expiresAt adds a remaining TTL in seconds to the time it was measured. If
+// that time is unknown, as for metadata not retrieved from the server, the
+// time of the last update is used instead.
+func expiresAt(asOf time.Time, updated time.Time, ttl int) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	if asOf.IsZero() {
+		asOf = updated
+	}
+	// TTLs are whole seconds, so finer precision would be spurious
+	return asOf.Add(time.Duration(ttl) * time.Second).Round(time.Second)
+}
+
+func isDestroyed(state SecretState) bool {
+	return state == SecretStateBurned || state == SecretStateReceived
+}
+
+func isExpired(expiry time.Time, now time.Time) bool {
+	return !expiry.IsZero() && !now.Before(expiry)
+}
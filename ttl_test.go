@@ -0,0 +1,85 @@
+package onetimesecret
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLSeconds(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want int
+	}{
+		{0, 0},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{90 * time.Minute, 5400},
+		{7 * 24 * time.Hour, 604800},
+	}
+	for _, tt := range tests {
+		if got := TTLSeconds(tt.in); got != tt.want {
+			t.Errorf("TTLSeconds(%v) = %v (want %v)", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSecretExpiresAt(t *testing.T) {
+	c, _ := newTestClient(t)
+	before := time.Now()
+	meta, err := c.Put(randStr(), "", 60, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	after := time.Now()
+
+	expiry := meta.SecretExpiresAt()
+	if expiry.Before(before.Add(58*time.Second)) || expiry.After(after.Add(61*time.Second)) {
+		t.Errorf("secret expires at %v (want about %v)", expiry, before.Add(time.Minute))
+	}
+	if !meta.MetadataExpiresAt().After(expiry) {
+		t.Errorf("metadata expires at %v (want after %v)", meta.MetadataExpiresAt(), expiry)
+	}
+	if meta.IsExpired(before) {
+		t.Errorf("secret expired at %v", before)
+	}
+	if !meta.IsExpired(after.Add(61 * time.Second)) {
+		t.Errorf("secret not expired at %v", after.Add(61*time.Second))
+	}
+}
+
+func TestSecretExpiresAtDestroyed(t *testing.T) {
+	c, _ := newTestClient(t)
+	meta, err := c.Put(randStr(), "", 60, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	meta, err = c.Burn(meta.MetadataKey, "")
+	if err != nil {
+		t.Fatalf("burn failed: %v", err)
+	}
+	if !meta.SecretExpiresAt().IsZero() {
+		t.Errorf("burned secret expires at %v (want zero time)", meta.SecretExpiresAt())
+	}
+	if meta.IsExpired(time.Now().Add(time.Hour)) {
+		t.Errorf("burned secret reported expired")
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	c, _ := newTestClient(t, WithDefaultTTL(90*time.Minute))
+	meta, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if meta.InitialMetadataTTL != 5400 {
+		t.Errorf("got TTL %v (want %v)", meta.InitialMetadataTTL, 5400)
+	}
+
+	meta, err = c.Put(randStr(), "", 60, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if meta.InitialMetadataTTL != 60 {
+		t.Errorf("got TTL %v (want %v)", meta.InitialMetadataTTL, 60)
+	}
+}
@@ -0,0 +1,67 @@
+package onetimesecret
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	secretPathSegment   = "secret"
+	metadataPathSegment = "private"
+)
+
+// ParseSecretURL returns the secret key in a secret URL, such as one returned
+// by Metadata.SecretURL. The URL may point to any host, so URLs of regional
+// and self-hosted servers are accepted, and any fragment is ignored. If s is
+// a bare secret key, ParseSecretURL returns it unchanged. If s is not a
+// secret URL, ParseSecretURL returns an error wrapping ErrInvalid.
+func ParseSecretURL(s string) (string, error) {
+	return parseShareURL(s, secretPathSegment)
+}
+
+// ParseMetadataURL returns the metadata key in a metadata URL, such as one
+// returned by Metadata.MetadataURL. It accepts the same forms as
+// ParseSecretURL and returns an error wrapping ErrInvalid if s is a secret
+// URL.
+func ParseMetadataURL(s string) (string, error) {
+	return parseShareURL(s, metadataPathSegment)
+}
+
+func parseShareURL(s string, kind string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", fmt.Errorf("%w: missing key", ErrInvalid)
+	}
+	if !strings.ContainsAny(s, "/#?") {
+		return s, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 2 || segments[len(segments)-1] == "" {
+		return "", fmt.Errorf("%w: not a %v URL: %v", ErrInvalid, urlKindName(kind), s)
+	}
+
+	gotKind := segments[len(segments)-2]
+	key := segments[len(segments)-1]
+	switch {
+	case gotKind == kind:
+		return key, nil
+	case gotKind == secretPathSegment || gotKind == metadataPathSegment:
+		return "", fmt.Errorf("%w: got a %v URL, need a %v URL", ErrInvalid, urlKindName(gotKind), urlKindName(kind))
+	default:
+		return "", fmt.Errorf("%w: not a %v URL: %v", ErrInvalid, urlKindName(kind), s)
+	}
+}
+
+func urlKindName(kind string) string {
+	if kind == metadataPathSegment {
+		return "metadata"
+	}
+	return "secret"
+}
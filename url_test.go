@@ -0,0 +1,84 @@
+package onetimesecret
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSecretURL(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"abc123", "abc123", false},
+		{"https://onetimesecret.com/secret/abc123", "abc123", false},
+		{"https://eu.onetimesecret.com/secret/abc123/", "abc123", false},
+		{"https://ots.example.com/share/secret/abc123#key", "abc123", false},
+		{"/secret/abc123", "abc123", false},
+		{"https://onetimesecret.com/private/xyz", "", true},
+		{"https://onetimesecret.com/", "", true},
+		{"https://onetimesecret.com/foo/abc123", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSecretURL(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("ParseSecretURL(%q): got error %v (want %v)", tt.in, err, ErrInvalid)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSecretURL(%q) failed: %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("ParseSecretURL(%q) = %v (want %v)", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseMetadataURL(t *testing.T) {
+	meta := Metadata{MetadataKey: "xyz", SecretKey: "abc"}
+	got, err := ParseMetadataURL(meta.MetadataURL().String())
+	if err != nil {
+		t.Fatalf("ParseMetadataURL failed: %v", err)
+	}
+	if got != "xyz" {
+		t.Errorf("got metadata key %v (want %v)", got, "xyz")
+	}
+
+	secretURL, err := meta.SecretURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseMetadataURL(secretURL.String()); !errors.Is(err, ErrInvalid) {
+		t.Errorf("got error %v (want %v)", err, ErrInvalid)
+	}
+}
+
+func TestClientAcceptsURLs(t *testing.T) {
+	want := randStr()
+	meta, err := c.Put(want, "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	got, err := c.GetMetadata(meta.MetadataURL().String())
+	if err != nil {
+		t.Fatalf("get metadata failed: %v", err)
+	}
+	if got.MetadataKey != meta.MetadataKey {
+		t.Errorf("got metadata key %v (want %v)", got.MetadataKey, meta.MetadataKey)
+	}
+
+	secretURL, err := meta.SecretURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := c.Get(secretURL.String(), "")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if secret != want {
+		t.Errorf("got secret %v (want %v)", secret, want)
+	}
+}
@@ -0,0 +1,250 @@
+package onetimesecret
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+// An APIVersion identifies a version of the One-Time Secret API.
+type APIVersion int
+
+const (
+	// APIVersion1 is the original API, which takes form parameters. It is
+	// used by default.
+	APIVersion1 APIVersion = 1
+
+	// APIVersion2 is the JSON API of newer servers. It supports share
+	// domains.
+	APIVersion2 APIVersion = 2
+)
+
+// WithAPIVersion sets the version of the API the client uses.
+func WithAPIVersion(v APIVersion) Option {
+	return func(c *Client) {
+		c.APIVersion = v
+	}
+}
+
+// WithShareDomain sets the custom domain of share URLs for secrets created by
+// the client. Share domains require APIVersion2.
+func WithShareDomain(domain string) Option {
+	return func(c *Client) {
+		c.ShareDomain = domain
+	}
+}
+
+func (c *Client) apiVersion() APIVersion {
+	if c.APIVersion == 0 {
+		return APIVersion1
+	}
+	return c.APIVersion
+}
+
+// doJSON is like do but encodes in as the JSON request body.
+func (c *Client) doJSON(ctx context.Context, method string, path string, in interface{}, idempotent bool, out interface{}) error {
+	var body *requestBody
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = &requestBody{contentType: "application/json", data: data}
+	}
+	return c.do(ctx, method, path, url.Values{}, body, idempotent, out)
+}
+
+func (c *Client) getV2(ctx context.Context, secretKey string, passphrase string) ([]byte, error) {
+	var r v2SecretResponse
+	path := "secret/" + url.PathEscape(secretKey) + "/reveal"
+	err := c.doJSON(ctx, "POST", path, v2PassphraseRequest{Passphrase: passphrase, Continue: true}, false, &r)
+	if err != nil {
+		return nil, err
+	}
+	return r.Record.SecretValue, nil
+}
+
+func (c *Client) putV2(ctx context.Context, secret []byte, opts PutOptions) (Metadata, error) {
+	if len(secret) == 0 {
+		return Metadata{}, ErrInvalid
+	}
+	req := c.newV2CreateRequest(opts.Passphrase, opts.TTL, opts.Recipient, opts.ShareDomain)
+	req.Secret.Secret = secret
+
+	var r v2CreateResponse
+	err := c.doJSON(ctx, "POST", "secret/conceal", req, false, &r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return c.newMetadataV2(r.Record.Metadata, r.Record.Secret.Key), nil
+}
+
+func (c *Client) generateV2(ctx context.Context, opts GenerateOptions) ([]byte, Metadata, error) {
+	req := c.newV2CreateRequest(opts.Passphrase, opts.TTL, opts.Recipient, opts.ShareDomain)
+
+	var r v2CreateResponse
+	err := c.doJSON(ctx, "POST", "secret/generate", req, false, &r)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return r.Record.Secret.SecretValue, c.newMetadataV2(r.Record.Metadata, r.Record.Secret.Key), nil
+}
+
+func (c *Client) burnV2(ctx context.Context, metadataKey string, passphrase string) (Metadata, error) {
+	var r v2MetadataResponse
+	path := "private/" + url.PathEscape(metadataKey) + "/burn"
+	err := c.doJSON(ctx, "POST", path, v2PassphraseRequest{Passphrase: passphrase, Continue: true}, false, &r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return c.newMetadataV2(r.Record, ""), nil
+}
+
+func (c *Client) getMetadataV2(ctx context.Context, metadataKey string) (Metadata, error) {
+	var r v2MetadataResponse
+	path := "private/" + url.PathEscape(metadataKey)
+	err := c.doJSON(ctx, "GET", path, nil, true, &r)
+	if err != nil {
+		return Metadata{}, err
+	}
+	return c.newMetadataV2(r.Record, ""), nil
+}
+
+func (c *Client) getRecentMetadataV2(ctx context.Context) ([]PartialMetadata, error) {
+	var r v2RecentResponse
+	err := c.doJSON(ctx, "GET", "private/recent", nil, true, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := []PartialMetadata{}
+	for _, rec := range r.Records {
+		m := PartialMetadata{asOf: time.Now()}
+		m.fromV2Record(rec)
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+func (c *Client) getSystemStatusV2(ctx context.Context) (SystemStatus, error) {
+	var r v2StatusResponse
+	err := c.doJSON(ctx, "GET", "status", nil, true, &r)
+	if err != nil {
+		return "", err
+	}
+	return parseSystemStatus(r.Status), nil
+}
+
+func (c *Client) newV2CreateRequest(passphrase string, ttl time.Duration, recipient string, shareDomain string) v2CreateRequest {
+	var req v2CreateRequest
+	req.Secret.Passphrase = passphrase
+	req.Secret.TTL = c.ttlSeconds(ttl)
+	req.Secret.Recipient = recipient
+	req.Secret.ShareDomain = shareDomain
+	if shareDomain == "" {
+		req.Secret.ShareDomain = c.ShareDomain
+	}
+	return req
+}
+
+// newMetadataV2 returns metadata for a v2 metadata record. If the record does
+// not include the secret key, secretKey is used instead.
+func (c *Client) newMetadataV2(rec v2MetadataRecord, secretKey string) Metadata {
+	m := Metadata{baseURL: c.baseURL(), asOf: time.Now()}
+	m.fromV2Record(rec)
+	if m.SecretKey == "" {
+		m.SecretKey = secretKey
+	}
+	return m
+}
+
+func (m *Metadata) fromV2Record(rec v2MetadataRecord) {
+	m.CustomerID = rec.CustomerID
+	m.MetadataKey = rec.Key
+	m.SecretKey = rec.SecretKey
+	m.InitialMetadataTTL = rec.Lifespan
+	m.MetadataTTL = rec.MetadataTTL
+	m.SecretTTL = rec.SecretTTL
+	m.State = parseSecretState(rec.State)
+	m.Updated = time.Unix(int64(rec.Updated), 0)
+	m.Created = time.Unix(int64(rec.Created), 0)
+	if len(rec.Recipients) > 0 {
+		m.ObfuscatedRecipient = rec.Recipients[0]
+	}
+	m.HasPassphrase = rec.HasPassphrase
+	m.ShareDomain = rec.ShareDomain
+}
+
+func (m *PartialMetadata) fromV2Record(rec v2MetadataRecord) {
+	m.CustomerID = rec.CustomerID
+	m.MetadataKey = rec.Key
+	m.InitialMetadataTTL = rec.Lifespan
+	m.MetadataTTL = rec.MetadataTTL
+	m.SecretTTL = rec.SecretTTL
+	m.State = parseSecretState(rec.State)
+	m.Updated = time.Unix(int64(rec.Updated), 0)
+	m.Created = time.Unix(int64(rec.Created), 0)
+	if len(rec.Recipients) > 0 {
+		m.Recipient = rec.Recipients[0]
+	}
+	m.ShareDomain = rec.ShareDomain
+}
+
+type v2CreateRequest struct {
+	Secret struct {
+		Secret      SecretBytes `json:"secret,omitempty"`
+		Passphrase  string      `json:"passphrase,omitempty"`
+		TTL         int         `json:"ttl,omitempty"`
+		Recipient   string      `json:"recipient,omitempty"`
+		ShareDomain string      `json:"share_domain,omitempty"`
+	} `json:"secret"`
+}
+
+type v2PassphraseRequest struct {
+	Passphrase string `json:"passphrase"`
+	Continue   bool   `json:"continue"`
+}
+
+type v2CreateResponse struct {
+	Record struct {
+		Metadata v2MetadataRecord `json:"metadata"`
+		Secret   v2SecretRecord   `json:"secret"`
+	} `json:"record"`
+}
+
+type v2MetadataResponse struct {
+	Record v2MetadataRecord `json:"record"`
+}
+
+type v2SecretResponse struct {
+	Record v2SecretRecord `json:"record"`
+}
+
+type v2RecentResponse struct {
+	Records []v2MetadataRecord `json:"records"`
+}
+
+type v2StatusResponse struct {
+	Status string `json:"status"`
+}
+
+type v2MetadataRecord struct {
+	Key           string   `json:"key"`
+	CustomerID    string   `json:"custid"`
+	SecretKey     string   `json:"secret_key"`
+	State         string   `json:"state"`
+	Created       int      `json:"created"`
+	Updated       int      `json:"updated"`
+	Lifespan      int      `json:"lifespan"`
+	MetadataTTL   int      `json:"metadata_ttl"`
+	SecretTTL     int      `json:"secret_ttl"`
+	Recipients    []string `json:"recipients"`
+	ShareDomain   string   `json:"share_domain"`
+	HasPassphrase bool     `json:"has_passphrase"`
+}
+
+type v2SecretRecord struct {
+	Key         string      `json:"key"`
+	SecretValue SecretBytes `json:"secret_value"`
+}
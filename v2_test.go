@@ -0,0 +1,142 @@
+package onetimesecret
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestV2PutGet(t *testing.T) {
+	c, srv := newTestClient(t, WithAPIVersion(APIVersion2))
+	want := randStr()
+	passphrase := randStr()
+	meta, err := c.Put(want, passphrase, 3600, "foo@example.com")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if meta.SecretKey == "" || meta.MetadataKey == "" {
+		t.Fatalf("missing keys in metadata %+v", meta)
+	}
+	if meta.State != SecretStateNew {
+		t.Errorf("wrong State %v (want %v)", meta.State, SecretStateNew)
+	}
+	if !meta.HasPassphrase {
+		t.Errorf("wrong HasPassphrase %v (want %v)", meta.HasPassphrase, true)
+	}
+	if meta.InitialMetadataTTL != 3600 {
+		t.Errorf("wrong InitialMetadataTTL %v (want %v)", meta.InitialMetadataTTL, 3600)
+	}
+	if meta.ObfuscatedRecipient != "fo*****@e*****.com" {
+		t.Errorf("wrong ObfuscatedRecipient %v", meta.ObfuscatedRecipient)
+	}
+
+	if _, err := c.Get(meta.SecretKey, "wrong"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v (want %v)", err, ErrNotFound)
+	}
+	got, err := c.Get(meta.SecretKey, passphrase)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("got secret %v (want %v)", got, want)
+	}
+	if n := srv.Requests("secret/" + meta.SecretKey + "/reveal"); n != 2 {
+		t.Errorf("got %v v2 reveal requests (want 2)", n)
+	}
+
+	meta, err = c.GetMetadata(meta.MetadataKey)
+	if err != nil {
+		t.Fatalf("get metadata failed: %v", err)
+	}
+	if meta.State != SecretStateReceived {
+		t.Errorf("wrong State %v (want %v)", meta.State, SecretStateReceived)
+	}
+}
+
+func TestV2PutNothing(t *testing.T) {
+	c, _ := newTestClient(t, WithAPIVersion(APIVersion2))
+	_, err := c.Put("", "", 0, "")
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("got error %v (want %v)", err, ErrInvalid)
+	}
+}
+
+func TestV2GenerateBurn(t *testing.T) {
+	c, _ := newTestClient(t, WithAPIVersion(APIVersion2))
+	secret, meta, err := c.Generate("", 0, "")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if secret == "" {
+		t.Errorf("empty secret")
+	}
+	burned, err := c.Burn(meta.MetadataKey, "")
+	if err != nil {
+		t.Fatalf("burn failed: %v", err)
+	}
+	if burned.State != SecretStateBurned {
+		t.Errorf("wrong State %v (want %v)", burned.State, SecretStateBurned)
+	}
+	if _, err := c.Get(meta.SecretKey, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v (want %v)", err, ErrNotFound)
+	}
+}
+
+func TestV2RecentAndStatus(t *testing.T) {
+	c, _ := newTestClient(t, WithAPIVersion(APIVersion2))
+	meta, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	metas, err := c.GetRecentMetadata()
+	if err != nil {
+		t.Fatalf("get recent metadata failed: %v", err)
+	}
+	if len(metas) != 1 || metas[0].MetadataKey != meta.MetadataKey {
+		t.Errorf("got recent metadata %v (want metadata key %v)", metas, meta.MetadataKey)
+	}
+	status, err := c.GetSystemStatus()
+	if err != nil {
+		t.Fatalf("get system status failed: %v", err)
+	}
+	if status != SystemStatusNominal {
+		t.Errorf("got status %v (want %v)", status, SystemStatusNominal)
+	}
+}
+
+func TestV2ShareDomainOption(t *testing.T) {
+	c, _ := newTestClient(t, WithAPIVersion(APIVersion2), WithShareDomain("secrets.example.com"))
+	meta, err := c.PutWithOptions(context.Background(), []byte(randStr()), PutOptions{ShareDomain: "eu.example.com"})
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if meta.ShareDomain != "eu.example.com" {
+		t.Errorf("wrong ShareDomain %v (want %v)", meta.ShareDomain, "eu.example.com")
+	}
+
+	_, meta, err = c.GenerateWithOptions(context.Background(), GenerateOptions{})
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if meta.ShareDomain != "secrets.example.com" {
+		t.Errorf("wrong ShareDomain %v (want %v)", meta.ShareDomain, "secrets.example.com")
+	}
+}
+
+func TestV2ShareDomain(t *testing.T) {
+	c, _ := newTestClient(t, WithAPIVersion(APIVersion2), WithShareDomain("secrets.example.com"))
+	meta, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if meta.ShareDomain != "secrets.example.com" {
+		t.Errorf("wrong ShareDomain %v (want %v)", meta.ShareDomain, "secrets.example.com")
+	}
+	secretURL, err := meta.SecretURL()
+	if err != nil {
+		t.Fatalf("SecretURL failed: %v", err)
+	}
+	if want := "https://secrets.example.com/secret/" + meta.SecretKey; secretURL.String() != want {
+		t.Errorf("got secret URL %v (want %v)", secretURL, want)
+	}
+}
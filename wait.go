@@ -0,0 +1,73 @@
+package onetimesecret
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrExpired is returned by WaitForState when a secret expires before
+// reaching any of the awaited states.
+var ErrExpired = errors.New("onetimesecret: secret expired")
+
+// waitMinInterval and waitMaxInterval bound the delay between the metadata
+// requests of WaitForState.
+var (
+	waitMinInterval = 2 * time.Second
+	waitMaxInterval = time.Minute
+)
+
+// WaitForState polls a secret's metadata, given its metadata key or metadata
+// URL, until the secret reaches one of the given states, and returns the
+// metadata. If no states are given, it waits until the secret is received or
+// burned. The delay between requests grows from 2s to 1m.
+//
+// If the secret expires first, WaitForState returns the last metadata
+// retrieved and ErrExpired. If the secret is received or burned without
+// reaching one of the states, it returns the metadata and ErrDestroyed. If
+// ctx is done first, it returns the last metadata retrieved and ctx's error.
+//
+// Retrieving metadata marks a new secret viewed, so waiting for
+// SecretStateViewed returns immediately.
+func (c *Client) WaitForState(ctx context.Context, metadataKey string, states ...SecretState) (Metadata, error) {
+	if len(states) == 0 {
+		states = []SecretState{SecretStateReceived, SecretStateBurned}
+	}
+
+	backoff := RetryPolicy{MinBackoff: waitMinInterval, MaxBackoff: waitMaxInterval}
+	var last Metadata
+	for attempt := 1; ; attempt++ {
+		m, err := c.GetMetadataContext(ctx, metadataKey)
+		if errors.Is(err, ErrNotFound) && attempt > 1 {
+			// the metadata outlives the secret, so the secret has expired too
+			return last, ErrExpired
+		} else if err != nil {
+			return last, err
+		}
+		last = m
+
+		for _, state := range states {
+			if m.State == state {
+				return m, nil
+			}
+		}
+		if isDestroyed(m.State) {
+			return m, ErrDestroyed
+		}
+
+		expiry := m.SecretExpiresAt()
+		if expiry.IsZero() || isExpired(expiry, time.Now()) {
+			return m, ErrExpired
+		}
+
+		// check again soon after the secret expires rather than waiting out
+		// the backoff, allowing a second for the server's rounding
+		delay := backoff.backoff(attempt)
+		if untilExpiry := time.Until(expiry) + time.Second; untilExpiry < delay {
+			delay = untilExpiry
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return last, err
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package onetimesecret
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func shortenWaitInterval(t *testing.T) {
+	min, max := waitMinInterval, waitMaxInterval
+	waitMinInterval, waitMaxInterval = time.Millisecond, 5*time.Millisecond
+	t.Cleanup(func() {
+		waitMinInterval, waitMaxInterval = min, max
+	})
+}
+
+func TestWaitForStateReceived(t *testing.T) {
+	shortenWaitInterval(t)
+	c, _ := newTestClient(t)
+	meta, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c.Get(meta.SecretKey, "")
+	}()
+
+	got, err := c.WaitForState(context.Background(), meta.MetadataKey)
+	if err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+	if got.State != SecretStateReceived {
+		t.Errorf("got state %v (want %v)", got.State, SecretStateReceived)
+	}
+}
+
+func TestWaitForStateDestroyed(t *testing.T) {
+	shortenWaitInterval(t)
+	c, _ := newTestClient(t)
+	meta, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if _, err := c.Burn(meta.MetadataKey, ""); err != nil {
+		t.Fatalf("burn failed: %v", err)
+	}
+
+	got, err := c.WaitForState(context.Background(), meta.MetadataKey, SecretStateReceived)
+	if !errors.Is(err, ErrDestroyed) {
+		t.Errorf("got error %v (want %v)", err, ErrDestroyed)
+	}
+	if got.State != SecretStateBurned {
+		t.Errorf("got state %v (want %v)", got.State, SecretStateBurned)
+	}
+}
+
+func TestWaitForStateExpired(t *testing.T) {
+	shortenWaitInterval(t)
+	c, srv := newTestClient(t)
+	meta, err := c.Put(randStr(), "", 60, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		srv.Advance(time.Minute)
+	}()
+
+	_, err = c.WaitForState(context.Background(), meta.MetadataKey)
+	if !errors.Is(err, ErrExpired) {
+		t.Errorf("got error %v (want %v)", err, ErrExpired)
+	}
+}
+
+func TestWaitForStateContext(t *testing.T) {
+	shortenWaitInterval(t)
+	c, _ := newTestClient(t)
+	meta, err := c.Put(randStr(), "", 0, "")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	got, err := c.WaitForState(ctx, meta.MetadataKey)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v (want %v)", err, context.DeadlineExceeded)
+	}
+	if got.MetadataKey != meta.MetadataKey {
+		t.Errorf("got metadata key %v (want %v)", got.MetadataKey, meta.MetadataKey)
+	}
+}